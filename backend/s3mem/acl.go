@@ -0,0 +1,140 @@
+package s3mem
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yottachain/YTCoreService/api"
+	"github.com/yottachain/YTCoreService/pkt"
+	"github.com/yottachain/YTS3/yts3"
+)
+
+func (db *Backend) ObjectACL(publicKey, bucketName, objectName string, versionID yts3.VersionID) (*yts3.AccessControlPolicy, error) {
+	if _, err := db.GetBucket(publicKey, bucketName); err != nil {
+		return nil, err
+	}
+	c := api.GetClient(publicKey)
+	if c == nil {
+		return nil, yts3.ResourceError(yts3.ErrInvalidAccessKeyID, "YTA"+publicKey)
+	}
+	rec, err := db.lookupObject(c, bucketName, objectName, versionID)
+	if err != nil {
+		return nil, err
+	}
+	return storedACL(rec.meta)
+}
+
+// SetObjectACL stores the ACL in the meta data of the object and licenses
+// the object to every user the ACL newly grants READ, through the same
+// Auth().LicensedTo call as the licensedTo REST API. A licence cannot be
+// taken back, so an ACL that drops a reader is refused. The stored ACL only
+// ever grants READ to the users already licensed: it is saved before the
+// new users are licensed, and again after each of them is, so that a
+// failure part-way leaves it listing exactly the users that were licensed.
+func (db *Backend) SetObjectACL(publicKey, bucketName, objectName string, versionID yts3.VersionID, acl *yts3.AccessControlPolicy) error {
+	if _, err := db.GetBucket(publicKey, bucketName); err != nil {
+		return err
+	}
+	c := api.GetClient(publicKey)
+	if c == nil {
+		return yts3.ResourceError(yts3.ErrInvalidAccessKeyID, "YTA"+publicKey)
+	}
+	rec, err := db.lookupObject(c, bucketName, objectName, versionID)
+	if err != nil {
+		return err
+	}
+	prev, err := storedACL(rec.meta)
+	if err != nil {
+		return err
+	}
+	readers := make(map[string]*api.Client)
+	for _, id := range acl.Readers() {
+		grantee := api.GetClient(strings.TrimPrefix(id, "YTA"))
+		if grantee == nil {
+			return yts3.ErrorMessagef(yts3.ErrInvalidArgument, "Invalid id: %s is not a user of this gateway", id)
+		}
+		readers[id] = grantee
+	}
+	licensed := make(map[string]bool)
+	if prev != nil {
+		for _, id := range prev.Readers() {
+			if _, ok := readers[id]; !ok {
+				return yts3.ErrorMessagef(yts3.ErrNotImplemented, "the licence of %s to read the object cannot be revoked", id)
+			}
+			// Already licensed.
+			licensed[id] = true
+			delete(readers, id)
+		}
+	}
+	if err := db.saveObjectACL(c, bucketName, objectName, rec, licensedACL(acl, licensed)); err != nil {
+		return err
+	}
+	if len(readers) == 0 {
+		return nil
+	}
+	auth, errMsg := c.Auth(bucketName, objectName)
+	if errMsg != nil {
+		logrus.Errorf("[ACL]/%s/%s,Auth ERR:%s\n", bucketName, objectName, errMsg)
+		return pkt.ToError(errMsg)
+	}
+	for id, grantee := range readers {
+		if errMsg := auth.LicensedTo(grantee.Username, strings.TrimPrefix(id, "YTA")); errMsg != nil {
+			logrus.Errorf("[ACL]/%s/%s,LicensedTo %s ERR:%s\n", bucketName, objectName, grantee.Username, errMsg)
+			return pkt.ToError(errMsg)
+		}
+		logrus.Infof("[ACL]/%s/%s,licensed to %s\n", bucketName, objectName, grantee.Username)
+		licensed[id] = true
+		if err := db.saveObjectACL(c, bucketName, objectName, rec, licensedACL(acl, licensed)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// licensedACL returns acl without the READ grants to the users that are not
+// licensed yet.
+func licensedACL(acl *yts3.AccessControlPolicy, licensed map[string]bool) *yts3.AccessControlPolicy {
+	readers := make(map[string]bool)
+	for _, id := range acl.Readers() {
+		readers[id] = true
+	}
+	saved := *acl
+	saved.AccessControlList.Grants = nil
+	for _, grant := range acl.AccessControlList.Grants {
+		if grant.Permission == yts3.PermissionRead && readers[grant.Grantee.ID] && !licensed[grant.Grantee.ID] {
+			continue
+		}
+		saved.AccessControlList.Grants = append(saved.AccessControlList.Grants, grant)
+	}
+	return &saved
+}
+
+// saveObjectACL stores acl in the meta data of the object rec was looked up
+// for.
+func (db *Backend) saveObjectACL(c *api.Client, bucketName, objectName string, rec *objectRecord, acl *yts3.AccessControlPolicy) error {
+	doc, err := xml.Marshal(acl)
+	if err != nil {
+		return err
+	}
+	rec.meta[yts3.ACLMetaKey] = string(doc)
+	metabs, err := api.FileMetaMapTobytes(rec.meta)
+	if err != nil {
+		logrus.Errorf("[ACL]/%s/%s,FileMetaMapTobytes:%s\n", bucketName, objectName, err)
+		return err
+	}
+	return db.saveObjectMeta(c, bucketName, objectName, rec.vnu, metabs)
+}
+
+// storedACL returns the ACL kept in the meta of an object, or nil.
+func storedACL(meta map[string]string) (*yts3.AccessControlPolicy, error) {
+	doc, ok := meta[yts3.ACLMetaKey]
+	if !ok || doc == "" {
+		return nil, nil
+	}
+	acl := &yts3.AccessControlPolicy{}
+	if err := xml.Unmarshal([]byte(doc), acl); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
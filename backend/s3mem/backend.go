@@ -22,6 +22,10 @@ type Backend struct {
 
 var _ yts3.Backend = &Backend{}
 var _ yts3.VersionedBackend = &Backend{}
+var _ yts3.CopyingBackend = &Backend{}
+var _ yts3.TaggingBackend = &Backend{}
+var _ yts3.BucketConfigBackend = &Backend{}
+var _ yts3.ACLBackend = &Backend{}
 
 type Option func(b *Backend)
 
@@ -3,6 +3,7 @@ package s3mem
 import (
 	"io"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -19,6 +20,13 @@ type bucket struct {
 	versioning   yts3.VersioningStatus
 	versionGen   versionGenFunc
 	creationDate yts3.ContentTime
+
+	// versioningLoaded is set once versioning has been read from the bucket
+	// meta, and configs once the sub-resource documents have been; mu guards
+	// all of them.
+	versioningLoaded bool
+	configs          map[string][]byte
+	mu               sync.Mutex
 }
 
 func newBucket(publicKey, bucketName string, at time.Time, versionGen versionGenFunc) *bucket {
@@ -26,7 +34,7 @@ func newBucket(publicKey, bucketName string, at time.Time, versionGen versionGen
 	bucketAccessor := c.NewBucketAccessor()
 	var header map[string]string
 	header = make(map[string]string)
-	header["version_status"] = "Enabled"
+	header[versionStatusKey] = string(yts3.VersioningEnabled)
 	meta, err := api.BucketMetaMapToBytes(header)
 	if err != nil {
 		logrus.Errorf("[CreateBucket]BucketMetaMapToBytes ERR:%s\n", err)
@@ -36,9 +44,11 @@ func newBucket(publicKey, bucketName string, at time.Time, versionGen versionGen
 		logrus.Error(err2)
 	}
 	return &bucket{
-		name:         bucketName,
-		creationDate: yts3.NewContentTime(at),
-		versionGen:   versionGen,
+		name:             bucketName,
+		creationDate:     yts3.NewContentTime(at),
+		versionGen:       versionGen,
+		versioning:       yts3.VersioningEnabled,
+		versioningLoaded: err == nil && err2 == nil,
 	}
 }
 
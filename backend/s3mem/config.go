@@ -0,0 +1,97 @@
+package s3mem
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yottachain/YTCoreService/api"
+	"github.com/yottachain/YTCoreService/pkt"
+	"github.com/yottachain/YTS3/yts3"
+)
+
+// bucketConfigPrefix marks the bucket meta entries that hold the documents
+// of the bucket sub-resources, e.g. "config.tagging".
+const bucketConfigPrefix = "config."
+
+// BucketConfig returns the document stored for a sub-resource of the bucket,
+// or nil if there is none. The documents are read from the bucket meta once
+// and then served from the bucket.
+func (db *Backend) BucketConfig(publicKey, bucketName, name string) ([]byte, error) {
+	b, err := db.GetBucket(publicKey, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	c := api.GetClient(publicKey)
+	if c == nil {
+		return nil, yts3.ResourceError(yts3.ErrInvalidAccessKeyID, "YTA"+publicKey)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.configs == nil {
+		meta, err := db.bucketMeta(c, bucketName)
+		if err != nil {
+			return nil, err
+		}
+		b.loadConfigs(meta)
+	}
+	return b.configs[name], nil
+}
+
+// SetBucketConfig stores the document of a sub-resource of the bucket in the
+// bucket meta. A nil doc deletes it.
+func (db *Backend) SetBucketConfig(publicKey, bucketName, name string, doc []byte) error {
+	b, err := db.GetBucket(publicKey, bucketName)
+	if err != nil {
+		return err
+	}
+	c := api.GetClient(publicKey)
+	if c == nil {
+		return yts3.ResourceError(yts3.ErrInvalidAccessKeyID, "YTA"+publicKey)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	meta, err := db.updateBucketMeta(c, bucketName, func(meta map[string]string) {
+		if doc == nil {
+			delete(meta, bucketConfigPrefix+name)
+		} else {
+			meta[bucketConfigPrefix+name] = string(doc)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	b.loadConfigs(meta)
+	logrus.Infof("[BucketConfig]%s %s,%d bytes\n", bucketName, name, len(doc))
+	return nil
+}
+
+// loadConfigs replaces the cached sub-resource documents with those in meta.
+// The caller must hold b.mu.
+func (b *bucket) loadConfigs(meta map[string]string) {
+	b.configs = make(map[string][]byte)
+	for k, v := range meta {
+		if strings.HasPrefix(k, bucketConfigPrefix) {
+			b.configs[strings.TrimPrefix(k, bucketConfigPrefix)] = []byte(v)
+		}
+	}
+}
+
+// updateBucketMeta reads the bucket meta, applies update to it and writes it
+// back, returning the new meta. The caller must hold the bucket's mu so that
+// concurrent updates from this gateway are not lost.
+func (db *Backend) updateBucketMeta(c *api.Client, bucketName string, update func(meta map[string]string)) (map[string]string, error) {
+	meta, err := db.bucketMeta(c, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	update(meta)
+	metabs, err := api.BucketMetaMapToBytes(meta)
+	if err != nil {
+		return nil, err
+	}
+	if errMsg := c.NewBucketAccessor().UpdateBucket(bucketName, metabs); errMsg != nil {
+		logrus.Errorf("[BucketConfig]UpdateBucket %s ERR:%s\n", bucketName, errMsg)
+		return nil, pkt.ToError(errMsg)
+	}
+	return meta, nil
+}
@@ -0,0 +1,140 @@
+package s3mem
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yottachain/YTCoreService/api"
+	"github.com/yottachain/YTCoreService/pkt"
+	"github.com/yottachain/YTS3/yts3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CopyObject copies without uploading the content again where YottaChain
+// allows it: zero length objects only exist as meta data and are created
+// anew, and a copy of the current version onto itself only replaces the meta
+// data of that version.
+//
+// The YottaChain client can only give a VNU its meta data under the name it
+// was uploaded with, so it offers no server-side copy of the content to
+// another key, or of an older version over the current one. Those copies are
+// reported with ErrNotImplemented, and the gateway streams them by reading
+// the source and uploading it again.
+func (db *Backend) CopyObject(publicKey, srcBucket, srcKey string, srcVersionID yts3.VersionID, dstBucket, dstKey string, meta map[string]string) (result yts3.ObjectCopyResult, err error) {
+	if _, err := db.GetBucket(publicKey, srcBucket); err != nil {
+		return result, err
+	}
+	if _, err := db.GetBucket(publicKey, dstBucket); err != nil {
+		return result, err
+	}
+	c := api.GetClient(publicKey)
+	if c == nil {
+		return result, yts3.ResourceError(yts3.ErrInvalidAccessKeyID, "YTA"+publicKey)
+	}
+	src, err := db.lookupObject(c, srcBucket, srcKey, srcVersionID)
+	if err != nil {
+		return result, err
+	}
+	vnu := src.vnu
+	switch {
+	case src.metaOnly:
+		vnu = primitive.NewObjectID()
+	case srcBucket == dstBucket && srcKey == dstKey:
+		current, err := db.currentVersion(c, srcBucket, srcKey)
+		if err != nil {
+			return result, err
+		}
+		if current != src.vnu {
+			return result, yts3.ErrorMessage(yts3.ErrNotImplemented, "an older version cannot be restored in place")
+		}
+	default:
+		return result, yts3.ErrorMessage(yts3.ErrNotImplemented, "the content cannot be linked under another name")
+	}
+	header := yts3.ObjectMetadata(meta)
+	header["ETag"] = src.meta["ETag"]
+	header["contentLength"] = src.meta["contentLength"]
+	metabs, err := api.FileMetaMapTobytes(header)
+	if err != nil {
+		logrus.Errorf("[CopyObject]/%s/%s,FileMetaMapTobytes:%s\n", dstBucket, dstKey, err)
+		return result, err
+	}
+	if errMsg := c.NewObjectAccessor().CreateObject(dstBucket, dstKey, vnu, metabs); errMsg != nil {
+		logrus.Errorf("[CopyObject]/%s/%s,CreateObject ERR:%s\n", dstBucket, dstKey, errMsg)
+		return result, pkt.ToError(errMsg)
+	}
+	// The copy is a new write, even if the content keeps the time of the VNU.
+	result.LastModified = time.Now()
+	if db.versioningEnabled(c, publicKey, dstBucket) {
+		result.VersionID = yts3.VersionID(vnu.Hex())
+	}
+	logrus.Infof("[CopyObject]/%s/%s,copied from /%s/%s,VNU:%s\n", dstBucket, dstKey, srcBucket, srcKey, vnu.Hex())
+	return result, nil
+}
+
+// objectRecord is the meta data YottaChain keeps for a version of an object.
+type objectRecord struct {
+	meta map[string]string
+
+	// vnu is the VNU of the content, or of the meta data alone for objects
+	// that have no content to download.
+	vnu      primitive.ObjectID
+	metaOnly bool
+}
+
+// lookupObject returns the record of the latest version of an object, or of
+// the given version.
+func (db *Backend) lookupObject(c *api.Client, bucketName, objectName string, versionID yts3.VersionID) (*objectRecord, error) {
+	var download *api.DownloadObject
+	var errMsg *pkt.ErrorMessage
+	version := primitive.NilObjectID
+	if versionID == "" {
+		download, errMsg = c.NewDownloadLastVersion(bucketName, objectName)
+	} else {
+		v, err := parseVersionID(versionID)
+		if err != nil {
+			return nil, err
+		}
+		version = v
+		download, errMsg = c.NewDownloadFile(bucketName, objectName, version)
+	}
+	rec := &objectRecord{}
+	var metabs []byte
+	if errMsg == nil {
+		metabs, rec.vnu = download.Meta, download.VNU
+	} else {
+		if errMsg.Code != pkt.INVALID_OBJECT_NAME {
+			logrus.Errorf("[S3Download]/%s/%s,download ERR:%s\n", bucketName, objectName, errMsg)
+			return nil, pkt.ToError(errMsg)
+		}
+		item, err := db.metaOnlyObject(c, bucketName, objectName, version)
+		if err != nil {
+			return nil, err
+		}
+		metabs, rec.vnu, rec.metaOnly = item.Meta, item.VersionId, true
+	}
+	meta, err := api.BytesToFileMetaMap(metabs, primitive.NilObjectID)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+	rec.meta = meta
+	return rec, nil
+}
+
+// metaOnlyObject looks up an object that has no content to download, either
+// its latest version or the given one.
+func (db *Backend) metaOnlyObject(c *api.Client, bucketName, objectName string, version primitive.ObjectID) (*api.ObjectItem, error) {
+	if !version.IsZero() {
+		return db.findVersion(c, bucketName, objectName, version)
+	}
+	items, errMsg := c.NewObjectAccessor().ListObject(bucketName, "", objectName, false, primitive.NilObjectID, 1)
+	if errMsg != nil {
+		return nil, pkt.ToError(errMsg)
+	}
+	if len(items) == 0 || items[0].FileName != objectName {
+		return nil, yts3.KeyNotFound(objectName)
+	}
+	return items[0], nil
+}
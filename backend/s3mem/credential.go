@@ -0,0 +1,41 @@
+package s3mem
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/yottachain/YTCoreService/api"
+	"github.com/yottachain/YTS3/yts3"
+)
+
+var _ yts3.CredentialProvider = &Backend{}
+
+// Credential resolves legacy "YTA<publicKey>" access keys to the registered
+// YottaChain user. Their secret is derived from the user's private key by
+// LegacySecretKey, so that the signing key itself never has to be handed to
+// S3 clients.
+func (db *Backend) Credential(accessKeyID string) (*yts3.Credential, error) {
+	if !strings.HasPrefix(accessKeyID, "YTA") {
+		return nil, yts3.ResourceError(yts3.ErrInvalidAccessKeyID, accessKeyID)
+	}
+	publicKey := yts3.PublicKeyFromAccessKey(accessKeyID)
+	c := api.GetClient(publicKey)
+	if c == nil || c.SignKey == nil {
+		return nil, yts3.ResourceError(yts3.ErrInvalidAccessKeyID, accessKeyID)
+	}
+	return &yts3.Credential{
+		AccessKey: accessKeyID,
+		SecretKey: LegacySecretKey(c.SignKey.PrivateKey),
+		PublicKey: publicKey,
+	}, nil
+}
+
+// LegacySecretKey returns the S3 secret key of the legacy "YTA<publicKey>"
+// access key of the user with the given private key.
+func LegacySecretKey(privateKey string) string {
+	h := hmac.New(sha256.New, []byte(privateKey))
+	h.Write([]byte("yts3"))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -3,6 +3,7 @@ package s3mem
 import (
 	"encoding/hex"
 	"io"
+	"net/http"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -23,32 +24,44 @@ func (db *Backend) GetObjectV2(publicKey, bucketName, objectName string, rangeRe
 	}
 	var metabs []byte
 	var t time.Time
+	var version primitive.ObjectID
 	download, errMsg := c.NewDownloadLastVersion(bucketName, objectName)
 	if errMsg != nil {
 		logrus.Errorf("[S3Download]NewDownloadLastVersion err:%s\n", errMsg)
 		if errMsg.Code == pkt.INVALID_OBJECT_NAME {
-			items, err := c.NewObjectAccessor().ListObject(bucketName, "", objectName, false, primitive.NilObjectID, uint32(page.MaxKeys))
+			// Zero length objects only exist as meta data.
+			item, err := db.metaOnlyObject(c, bucketName, objectName, primitive.NilObjectID)
 			if err != nil {
-				return nil, pkt.ToError(errMsg)
-			}
-			if len(items) > 0 {
-				metabs = items[0].Meta
-				t = items[0].FileId.Timestamp()
-			} else {
-				return nil, yts3.ErrNoSuchKey
+				return nil, err
 			}
+			metabs = item.Meta
+			t = item.FileId.Timestamp()
+			version = item.VersionId
 		} else {
 			return nil, pkt.ToError(errMsg)
 		}
 	} else {
 		metabs = download.Meta
 		t = download.GetTime()
+		version = download.VNU
+	}
+	if !db.versioningEnabled(c, publicKey, bucketName) {
+		version = primitive.NilObjectID
 	}
+	return db.downloadObject(c, objectName, download, metabs, t, version, rangeRequest)
+}
+
+// downloadObject builds the yts3.Object for a download. metabs and t are the
+// object meta and creation time; download may be nil for objects that only
+// exist as meta data (e.g. zero length objects). version is reported as the
+// object's VersionID unless it is the nil ObjectID.
+func (db *Backend) downloadObject(c *api.Client, objectName string, download *api.DownloadObject, metabs []byte, t time.Time, version primitive.ObjectID, rangeRequest *yts3.ObjectRangeRequest) (*yts3.Object, error) {
 	meta, err := api.BytesToFileMetaMap(metabs, primitive.NilObjectID)
 	if err != nil {
 		return nil, err
 	}
 	meta["x-amz-meta-s3b-last-modified"] = t.Format("20060102T150405Z")
+	meta["Last-Modified"] = t.UTC().Format(http.TimeFormat)
 	content := getContentByMeta(meta)
 	content.Key = objectName
 	content.Owner = &yts3.UserInfo{
@@ -71,27 +84,56 @@ func (db *Backend) GetObjectV2(publicKey, bucketName, objectName string, rangeRe
 	content = getContentByMeta(result.Metadata)
 	result.Size = content.Size
 	if result.Size > 0 {
-		if rangeRequest != nil {
-			if rangeRequest.End == -1 {
-				rangeRequest.End = content.Size
-				rangeRequest.FromEnd = true
-			}
-			result.Contents = &ContentReader{download.LoadRange(rangeRequest.Start, rangeRequest.End).(io.ReadCloser)}
-			result.Range = &yts3.ObjectRange{
-				Start:  rangeRequest.Start,
-				Length: rangeRequest.End - rangeRequest.Start,
-			}
+		if result.Range != nil {
+			// LoadRange reads up to, but not including, the end offset.
+			rng := result.Range
+			result.Contents = &lazyContents{download: download, open: func() io.ReadCloser {
+				return &ContentReader{download.LoadRange(rng.Start, rng.Start+rng.Length).(io.ReadCloser)}
+			}}
 		} else {
-			result.Contents = &ContentReader{download.Load().(io.ReadCloser)}
+			result.Contents = &lazyContents{download: download, open: func() io.ReadCloser {
+				return &ContentReader{download.Load().(io.ReadCloser)}
+			}}
 		}
 	} else if result.Size == 0 {
 		result.Contents = &ZeroReader{}
 	}
 	hash, _ = hex.DecodeString(content.ETag)
 	result.Hash = hash
+	if !version.IsZero() {
+		result.VersionID = yts3.VersionID(version.Hex())
+	}
 	return result, nil
 }
 
+// lazyContents opens the download on the first Read, so that HEAD requests
+// and requests that fail a precondition do not start fetching the object.
+type lazyContents struct {
+	download *api.DownloadObject
+	open     func() io.ReadCloser
+	rc       io.ReadCloser
+}
+
+func (lc *lazyContents) Read(buf []byte) (int, error) {
+	if lc.rc == nil {
+		lc.rc = lc.open()
+	}
+	return lc.rc.Read(buf)
+}
+
+func (lc *lazyContents) Close() error {
+	if lc.rc == nil {
+		return nil
+	}
+	return lc.rc.Close()
+}
+
+// ReadRange implements yts3.RangeReader with a separate LoadRange of the
+// download for each range.
+func (lc *lazyContents) ReadRange(start, length int64) (io.ReadCloser, error) {
+	return &ContentReader{lc.download.LoadRange(start, start+length).(io.ReadCloser)}, nil
+}
+
 type ZeroReader struct {
 	io.ReadCloser
 }
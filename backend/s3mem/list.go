@@ -2,8 +2,10 @@ package s3mem
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/patrickmn/go-cache"
 	"github.com/sirupsen/logrus"
@@ -82,12 +84,19 @@ func (db *Backend) ListBuckets(publicKey string) ([]yts3.BucketInfo, error) {
 	return buckets, nil
 }
 
+// skipPrefix is appended to a common prefix to list from the first key after
+// every key that rolls up into it.
+const skipPrefix = string(utf8.MaxRune)
+
 func (me *Backend) ListBucket(publicKey, name string, prefix *yts3.Prefix, page yts3.ListBucketPage) (*yts3.ObjectList, error) {
 	var response = yts3.NewObjectList()
 	c := api.GetClient(publicKey)
 	if c == nil {
 		return nil, yts3.ResourceError(yts3.ErrInvalidAccessKeyID, "YTA"+publicKey)
 	}
+	if page.MaxKeys <= 0 {
+		return response, nil
+	}
 	objectAccessor := c.NewObjectAccessor()
 	startFile := ""
 	if page.HasMarker {
@@ -97,34 +106,83 @@ func (me *Backend) ListBucket(publicKey, name string, prefix *yts3.Prefix, page
 	if prefix.HasPrefix {
 		pfix = prefix.Prefix
 	}
-	items, err := objectAccessor.ListObject(name, startFile, pfix, false, primitive.NilObjectID, uint32(page.MaxKeys))
-	if err != nil {
-		return response, fmt.Errorf(err.String())
+	owner := &yts3.UserInfo{
+		ID:          c.Username,
+		DisplayName: c.Username,
 	}
-	logrus.Infof("[ListObjects]Response %d items\n", len(items))
-	lastFile := ""
-	num := 0
-	for _, v := range items {
-		num++
-		meta, err := api.BytesToFileMetaMap(v.Meta, primitive.ObjectID{})
+	// Keys that roll up into a common prefix are reported once, so a page
+	// can take several batches to fill.
+	var (
+		count      int64
+		lastEntry  string
+		lastPrefix string
+		match      yts3.PrefixMatch
+	)
+	// The listing may start with startFile itself, so one more item than the
+	// page holds is asked for to make progress past it. The page is only
+	// truncated once an item that would go on the next one has been seen.
+	batch := page.MaxKeys + 1
+	for {
+		items, err := objectAccessor.ListObject(name, startFile, pfix, false, primitive.NilObjectID, uint32(batch))
 		if err != nil {
-			logrus.Warnf("[ListObjects]ERR meta,filename:%s\n", v.FileName)
-			continue
+			return response, fmt.Errorf(err.String())
+		}
+		logrus.Infof("[ListObjects]Response %d items\n", len(items))
+		for _, v := range items {
+			if !prefix.Match(v.FileName, &match) {
+				continue
+			}
+			entry := v.FileName
+			if match.CommonPrefix {
+				entry = match.MatchedPart
+				if entry == lastPrefix {
+					continue
+				}
+			}
+			if page.HasMarker && entry <= page.Marker {
+				if match.CommonPrefix {
+					lastPrefix = entry
+				}
+				continue
+			}
+			if count >= page.MaxKeys {
+				response.IsTruncated = true
+				break
+			}
+			if match.CommonPrefix {
+				response.AddPrefix(entry)
+				lastPrefix = entry
+			} else {
+				meta, err := api.BytesToFileMetaMap(v.Meta, primitive.ObjectID{})
+				if err != nil {
+					logrus.Warnf("[ListObjects]ERR meta,filename:%s\n", v.FileName)
+					continue
+				}
+				t := time.Unix(v.FileId.Timestamp().Unix(), 0)
+				meta["x-amz-meta-s3b-last-modified"] = t.Format("20060102T150405Z")
+				content := getContentByMeta(meta)
+				content.Key = v.FileName
+				content.Owner = owner
+				response.Contents = append(response.Contents, content)
+			}
+			lastEntry = entry
+			count++
+		}
+		if response.IsTruncated || int64(len(items)) < batch {
+			break
+		}
+		next := items[len(items)-1].FileName
+		if lastPrefix != "" && strings.HasPrefix(next, lastPrefix) {
+			next = lastPrefix + skipPrefix
 		}
-		t := time.Unix(v.FileId.Timestamp().Unix(), 0)
-		meta["x-amz-meta-s3b-last-modified"] = t.Format("20060102T150405Z")
-		content := getContentByMeta(meta)
-		content.Key = v.FileName
-		content.Owner = &yts3.UserInfo{
-			ID:          c.Username,
-			DisplayName: c.Username,
+		if next <= startFile {
+			logrus.Warnf("[ListObjects]%s,listing does not advance past %s\n", name, startFile)
+			break
 		}
-		response.Contents = append(response.Contents, content)
-		lastFile = v.FileName
+		startFile = next
 	}
-	if int64(num) >= page.MaxKeys {
-		response.NextMarker = lastFile
-		response.IsTruncated = true
+	if response.IsTruncated {
+		response.NextMarker = lastEntry
 	}
 	return response, nil
 }
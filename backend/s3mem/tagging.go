@@ -0,0 +1,50 @@
+package s3mem
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/yottachain/YTCoreService/api"
+	"github.com/yottachain/YTS3/yts3"
+)
+
+func (db *Backend) ObjectTagging(publicKey, bucketName, objectName string, versionID yts3.VersionID) (tagging yts3.Tagging, err error) {
+	if _, err := db.GetBucket(publicKey, bucketName); err != nil {
+		return tagging, err
+	}
+	c := api.GetClient(publicKey)
+	if c == nil {
+		return tagging, yts3.ResourceError(yts3.ErrInvalidAccessKeyID, "YTA"+publicKey)
+	}
+	rec, err := db.lookupObject(c, bucketName, objectName, versionID)
+	if err != nil {
+		return tagging, err
+	}
+	return yts3.ParseTagging(rec.meta[yts3.TaggingMetaKey])
+}
+
+// SetObjectTagging replaces the tag set kept in the meta data of an object
+// version; an empty tag set removes it.
+func (db *Backend) SetObjectTagging(publicKey, bucketName, objectName string, versionID yts3.VersionID, tagging yts3.Tagging) error {
+	if _, err := db.GetBucket(publicKey, bucketName); err != nil {
+		return err
+	}
+	c := api.GetClient(publicKey)
+	if c == nil {
+		return yts3.ResourceError(yts3.ErrInvalidAccessKeyID, "YTA"+publicKey)
+	}
+	rec, err := db.lookupObject(c, bucketName, objectName, versionID)
+	if err != nil {
+		return err
+	}
+	if len(tagging.TagSet.Tags) == 0 {
+		delete(rec.meta, yts3.TaggingMetaKey)
+	} else {
+		rec.meta[yts3.TaggingMetaKey] = tagging.Encode()
+	}
+	metabs, err := api.FileMetaMapTobytes(rec.meta)
+	if err != nil {
+		logrus.Errorf("[Tagging]/%s/%s,FileMetaMapTobytes:%s\n", bucketName, objectName, err)
+		return err
+	}
+	logrus.Infof("[Tagging]/%s/%s,%d tags\n", bucketName, objectName, len(tagging.TagSet.Tags))
+	return db.saveObjectMeta(c, bucketName, objectName, rec.vnu, metabs)
+}
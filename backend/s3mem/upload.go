@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -22,10 +23,18 @@ var Object_UP_CH chan int
 var Object_Timeout int = 60
 var SyncFileMin int
 
+// MetaRetryTimeout is how long the meta data of an object that is still
+// queued for upload is kept, waiting for the version it belongs to.
+var MetaRetryTimeout = time.Hour
+
+// metaRetryInterval is how often a queued upload is looked for.
+const metaRetryInterval = 10 * time.Second
+
 func InitObjectUpPool() {
 	MaxCreateObjNum := env.GetConfig().GetRangeInt("MaxCreateObjNum", 20, 500, 50)
 	Object_Timeout = env.GetConfig().GetRangeInt("ObjectTimeout", 10, 300, 60)
 	SyncFileMin = env.GetConfig().GetRangeInt("SyncFileMin", 1, 10, 2) * 1024 * 1024
+	MetaRetryTimeout = time.Duration(env.GetConfig().GetRangeInt("MetaRetryMinutes", 1, 1440, 60)) * time.Minute
 	Object_UP_CH = make(chan int, MaxCreateObjNum)
 	for ii := 0; ii < MaxCreateObjNum; ii++ {
 		Object_UP_CH <- 1
@@ -43,7 +52,8 @@ func (db *Backend) PutObject(publicKey, bucketName, objectName string, meta map[
 	}
 	var hash []byte
 	var bts []byte
-	header := make(map[string]string)
+	header := yts3.ObjectMetadata(meta)
+	custom := len(header) > 0
 	if size >= int64(SyncFileMin) {
 		u1 := primitive.NewObjectID().Hex()
 		errw := writeCacheFile(env.GetS3Cache(), u1, input)
@@ -96,13 +106,27 @@ func (db *Backend) PutObject(publicKey, bucketName, objectName string, meta map[
 		logrus.Errorf("[S3Upload]/%s/%s,FileMetaMapTobytes:%s\n", bucketName, objectName, err2)
 		return result, err2
 	}
+	version := primitive.NilObjectID
 	if size == 0 {
-		errzero := c.NewObjectAccessor().CreateObject(bucketName, objectName, primitive.NewObjectID(), metadata2)
+		version = primitive.NewObjectID()
+		errzero := c.NewObjectAccessor().CreateObject(bucketName, objectName, version, metadata2)
 		if errzero != nil {
 			logrus.Errorf("[S3Upload]/%s/%s,Save meta data ERR:%s\n", bucketName, objectName, errzero)
 			return result, pkt.ToError(errzero)
 		}
 	}
+	if size > 0 && custom {
+		if version, err = db.attachObjectMeta(c, bucketName, objectName, hash, metadata2); err != nil {
+			return result, err
+		}
+	} else if size > 0 {
+		if version, _, err = db.uploadedVersion(c, bucketName, objectName, hash); err != nil {
+			logrus.Warnf("[S3Upload]/%s/%s,uploaded version err:%s\n", bucketName, objectName, err)
+		}
+	}
+	if db.versioningEnabled(c, publicKey, bucketName) && !version.IsZero() {
+		result.VersionID = yts3.VersionID(version.Hex())
+	}
 	logrus.Infof("[S3Upload]/%s/%sFile upload success,file md5 value : %s\n", bucketName, objectName, hex.EncodeToString(hash[:]))
 	return result, nil
 }
@@ -148,7 +172,7 @@ func writeCacheFile(directory, fileName string, input io.Reader) error {
 	return nil
 }
 
-func (db *Backend) MultipartUpload(publicKey, bucketName, objectName string, partsPath []string, size int64) (result yts3.PutObjectResult, err error) {
+func (db *Backend) MultipartUpload(publicKey, bucketName, objectName string, meta map[string]string, partsPath []string, size int64, etag string) (result yts3.PutObjectResult, err error) {
 	_, er := db.GetBucket(publicKey, bucketName)
 	if er != nil {
 		return result, er
@@ -160,8 +184,101 @@ func (db *Backend) MultipartUpload(publicKey, bucketName, objectName string, par
 	md5Bytes, errB := c.UploadMultiPartFile(partsPath, bucketName, objectName)
 	if errB != nil {
 		logrus.Errorf("[S3Upload]MultipartUpload /%s/%s,err:%s\n", bucketName, objectName, errB)
-		return
+		return result, pkt.ToError(errB)
 	}
 	logrus.Infof("[S3Upload]MultipartUpload /%s/%s,File upload success,file md5 value : %s\n", bucketName, objectName, hex.EncodeToString(md5Bytes[:]))
+	// The client was given the composite ETag of the parts, not the MD5 of
+	// the whole object, so that is the ETag stored and reported later.
+	header := yts3.ObjectMetadata(meta)
+	header["ETag"] = strings.Trim(etag, `"`)
+	header["contentLength"] = strconv.FormatInt(size, 10)
+	metabs, err := api.FileMetaMapTobytes(header)
+	if err != nil {
+		logrus.Errorf("[S3Upload]MultipartUpload /%s/%s,FileMetaMapTobytes:%s\n", bucketName, objectName, err)
+		return result, err
+	}
+	version, err := db.attachObjectMeta(c, bucketName, objectName, md5Bytes, metabs)
+	if err != nil {
+		return result, err
+	}
+	if db.versioningEnabled(c, publicKey, bucketName) && !version.IsZero() {
+		result.VersionID = yts3.VersionID(version.Hex())
+	}
 	return result, nil
 }
+
+// saveObjectMeta replaces the meta stored with a version of an object. The
+// upload calls of the client only store the ETag and the length, so the
+// headers that come with the object are written once it has been uploaded.
+func (db *Backend) saveObjectMeta(c *api.Client, bucketName, objectName string, version primitive.ObjectID, metabs []byte) error {
+	if version.IsZero() {
+		logrus.Errorf("[S3Upload]/%s/%s,no version to save meta to\n", bucketName, objectName)
+		return yts3.KeyNotFound(objectName)
+	}
+	if errMsg := c.NewObjectAccessor().CreateObject(bucketName, objectName, version, metabs); errMsg != nil {
+		logrus.Errorf("[S3Upload]/%s/%s,Save meta data ERR:%s\n", bucketName, objectName, errMsg)
+		return pkt.ToError(errMsg)
+	}
+	return nil
+}
+
+// uploadedVersion returns the version created by an upload of the content
+// with the MD5 sum: the latest version of the object, as long as no other
+// write has replaced it since. found is false while the upload is still
+// queued.
+func (db *Backend) uploadedVersion(c *api.Client, bucketName, objectName string, sum []byte) (version primitive.ObjectID, found bool, err error) {
+	download, errMsg := c.NewDownloadLastVersion(bucketName, objectName)
+	if errMsg != nil {
+		if errMsg.Code == pkt.INVALID_OBJECT_NAME {
+			return primitive.NilObjectID, false, nil
+		}
+		return primitive.NilObjectID, false, pkt.ToError(errMsg)
+	}
+	meta, err := api.BytesToFileMetaMap(download.Meta, primitive.NilObjectID)
+	if err != nil {
+		return primitive.NilObjectID, true, err
+	}
+	if meta["ETag"] != hex.EncodeToString(sum) {
+		return primitive.NilObjectID, true, yts3.ErrorMessage(yts3.ErrOperationAborted, "The object was replaced by another write before its metadata could be saved")
+	}
+	return download.VNU, true, nil
+}
+
+// attachObjectMeta saves metabs with the version created by an upload of the
+// content with the MD5 sum. If the upload is still queued, the meta data is
+// queued with it and saved once the version exists; the nil ObjectID is
+// returned then.
+func (db *Backend) attachObjectMeta(c *api.Client, bucketName, objectName string, sum, metabs []byte) (primitive.ObjectID, error) {
+	version, found, err := db.uploadedVersion(c, bucketName, objectName, sum)
+	if err != nil {
+		logrus.Errorf("[S3Upload]/%s/%s,uploaded version ERR:%s\n", bucketName, objectName, err)
+		return version, err
+	}
+	if !found {
+		logrus.Infof("[S3Upload]/%s/%s,upload queued,meta data saved once it is stored\n", bucketName, objectName)
+		go db.attachObjectMetaLater(c, bucketName, objectName, sum, metabs)
+		return version, nil
+	}
+	return version, db.saveObjectMeta(c, bucketName, objectName, version, metabs)
+}
+
+func (db *Backend) attachObjectMetaLater(c *api.Client, bucketName, objectName string, sum, metabs []byte) {
+	deadline := time.Now().Add(MetaRetryTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(metaRetryInterval)
+		version, found, err := db.uploadedVersion(c, bucketName, objectName, sum)
+		if yts3.HasErrorCode(err, yts3.ErrOperationAborted) {
+			logrus.Errorf("[S3Upload]/%s/%s,meta data dropped:%s\n", bucketName, objectName, err)
+			return
+		}
+		if err != nil || !found {
+			continue
+		}
+		if err := db.saveObjectMeta(c, bucketName, objectName, version, metabs); err != nil {
+			continue
+		}
+		logrus.Infof("[S3Upload]/%s/%s,meta data saved to queued upload %s\n", bucketName, objectName, version.Hex())
+		return
+	}
+	logrus.Errorf("[S3Upload]/%s/%s,upload still queued after %s,meta data dropped\n", bucketName, objectName, MetaRetryTimeout)
+}
@@ -0,0 +1,408 @@
+package s3mem
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yottachain/YTCoreService/api"
+	"github.com/yottachain/YTCoreService/pkt"
+	"github.com/yottachain/YTS3/yts3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// versionStatusKey is the bucket meta entry holding the versioning status.
+const versionStatusKey = "version_status"
+
+// parseVersionID converts an S3 version id back into the YottaChain VersionId
+// it was made from.
+func parseVersionID(versionID yts3.VersionID) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(string(versionID))
+	if err != nil {
+		return id, yts3.ResourceError(yts3.ErrNoSuchVersion, string(versionID))
+	}
+	return id, nil
+}
+
+func (db *Backend) bucketMeta(c *api.Client, bucketName string) (map[string]string, error) {
+	metabs, errMsg := c.NewBucketAccessor().GetBucket(bucketName)
+	if errMsg != nil {
+		if errMsg.Code == pkt.INVALID_BUCKET_NAME {
+			return nil, yts3.BucketNotFound(bucketName)
+		}
+		logrus.Errorf("[Versioning]GetBucket %s ERR:%s\n", bucketName, errMsg)
+		return nil, pkt.ToError(errMsg)
+	}
+	meta, err := api.BytesToBucketMetaMap(metabs)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+	return meta, nil
+}
+
+func (db *Backend) bucketVersioning(c *api.Client, publicKey, bucketName string) (yts3.VersioningStatus, error) {
+	b, err := db.GetBucket(publicKey, bucketName)
+	if err != nil {
+		return yts3.VersioningNone, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.versioningLoaded {
+		return b.versioning, nil
+	}
+	meta, err := db.bucketMeta(c, bucketName)
+	if err != nil {
+		return yts3.VersioningNone, err
+	}
+	switch status := yts3.VersioningStatus(meta[versionStatusKey]); status {
+	case yts3.VersioningEnabled, yts3.VersioningSuspended:
+		b.versioning = status
+	default:
+		b.versioning = yts3.VersioningNone
+	}
+	b.versioningLoaded = true
+	return b.versioning, nil
+}
+
+func (db *Backend) versioningEnabled(c *api.Client, publicKey, bucketName string) bool {
+	status, err := db.bucketVersioning(c, publicKey, bucketName)
+	if err != nil {
+		logrus.Warnf("[Versioning]%s status err:%s\n", bucketName, err)
+		return false
+	}
+	return status == yts3.VersioningEnabled
+}
+
+// findVersion looks up a single version of an object in the version listing,
+// paging through the versions of the keys that share its name as a prefix
+// until the object has been passed.
+func (db *Backend) findVersion(c *api.Client, bucketName, objectName string, version primitive.ObjectID) (*api.ObjectItem, error) {
+	startFile, startVersion := "", primitive.NilObjectID
+	for {
+		items, errMsg := c.NewObjectAccessor().ListObject(bucketName, startFile, objectName, true, startVersion, uint32(yts3.MaxBucketVersionKeys))
+		if errMsg != nil {
+			return nil, pkt.ToError(errMsg)
+		}
+		for _, item := range items {
+			if item.FileName == objectName && item.VersionId == version {
+				return item, nil
+			}
+			if item.FileName > objectName {
+				return nil, yts3.ResourceError(yts3.ErrNoSuchVersion, version.Hex())
+			}
+		}
+		if len(items) < yts3.MaxBucketVersionKeys {
+			break
+		}
+		last := items[len(items)-1]
+		if last.FileName == startFile && last.VersionId == startVersion {
+			break
+		}
+		startFile, startVersion = last.FileName, last.VersionId
+	}
+	return nil, yts3.ResourceError(yts3.ErrNoSuchVersion, version.Hex())
+}
+
+// currentVersion returns the VersionId of the latest version of an object,
+// or the nil ObjectID if the object has no current version.
+func (db *Backend) currentVersion(c *api.Client, bucketName, objectName string) (primitive.ObjectID, error) {
+	item, err := db.metaOnlyObject(c, bucketName, objectName, primitive.NilObjectID)
+	if err != nil {
+		if yts3.HasErrorCode(err, yts3.ErrNoSuchKey) {
+			return primitive.NilObjectID, nil
+		}
+		return primitive.NilObjectID, err
+	}
+	return item.VersionId, nil
+}
+
+func (db *Backend) VersioningConfiguration(publicKey, bucketName string) (result yts3.VersioningConfiguration, err error) {
+	c := api.GetClient(publicKey)
+	if c == nil {
+		return result, yts3.ResourceError(yts3.ErrInvalidAccessKeyID, "YTA"+publicKey)
+	}
+	result.Status, err = db.bucketVersioning(c, publicKey, bucketName)
+	return result, err
+}
+
+func (db *Backend) SetVersioningConfiguration(publicKey, bucketName string, v yts3.VersioningConfiguration) error {
+	b, err := db.GetBucket(publicKey, bucketName)
+	if err != nil {
+		return err
+	}
+	c := api.GetClient(publicKey)
+	if c == nil {
+		return yts3.ResourceError(yts3.ErrInvalidAccessKeyID, "YTA"+publicKey)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	meta, err := db.updateBucketMeta(c, bucketName, func(meta map[string]string) {
+		meta[versionStatusKey] = string(v.Status)
+	})
+	if err != nil {
+		return err
+	}
+	b.loadConfigs(meta)
+	b.versioning = v.Status
+	b.versioningLoaded = true
+	return nil
+}
+
+func (db *Backend) GetObjectVersion(publicKey, bucketName, objectName string, versionID yts3.VersionID, rangeRequest *yts3.ObjectRangeRequest) (*yts3.Object, error) {
+	if _, err := db.GetBucket(publicKey, bucketName); err != nil {
+		return nil, err
+	}
+	c := api.GetClient(publicKey)
+	if c == nil {
+		return nil, yts3.ResourceError(yts3.ErrInvalidAccessKeyID, "YTA"+publicKey)
+	}
+	version, err := parseVersionID(versionID)
+	if err != nil {
+		return nil, err
+	}
+	download, errMsg := c.NewDownloadFile(bucketName, objectName, version)
+	if errMsg != nil {
+		logrus.Errorf("[S3Download]NewDownloadFile /%s/%s,%s err:%s\n", bucketName, objectName, versionID, errMsg)
+		if errMsg.Code != pkt.INVALID_OBJECT_NAME {
+			return nil, pkt.ToError(errMsg)
+		}
+		// Zero length objects only exist as meta data.
+		item, err := db.findVersion(c, bucketName, objectName, version)
+		if err != nil {
+			return nil, err
+		}
+		return db.downloadObject(c, objectName, nil, item.Meta, item.FileId.Timestamp(), version, rangeRequest)
+	}
+	return db.downloadObject(c, objectName, download, download.Meta, download.GetTime(), version, rangeRequest)
+}
+
+func (db *Backend) HeadObjectVersion(publicKey, bucketName, objectName string, versionID yts3.VersionID) (*yts3.Object, error) {
+	return db.GetObjectVersion(publicKey, bucketName, objectName, versionID, nil)
+}
+
+func (db *Backend) DeleteObjectVersion(publicKey, bucketName, objectName string, versionID yts3.VersionID) (result yts3.ObjectDeleteResult, err error) {
+	if _, err := db.GetBucket(publicKey, bucketName); err != nil {
+		return result, err
+	}
+	c := api.GetClient(publicKey)
+	if c == nil {
+		return result, yts3.ResourceError(yts3.ErrInvalidAccessKeyID, "YTA"+publicKey)
+	}
+	version, err := parseVersionID(versionID)
+	if err != nil {
+		return result, err
+	}
+	if errMsg := c.NewObjectAccessor().DeleteObject(bucketName, objectName, version); errMsg != nil {
+		logrus.Errorf("[S3Delete]/%s/%s,%s,Err:%s\n", bucketName, objectName, versionID, errMsg)
+		if errMsg.Code == pkt.INVALID_OBJECT_NAME {
+			return result, yts3.ResourceError(yts3.ErrNoSuchVersion, string(versionID))
+		}
+		return result, pkt.ToError(errMsg)
+	}
+	result.VersionID = versionID
+	return result, nil
+}
+
+func (db *Backend) ListBucketVersions(publicKey, bucketName string, prefix *yts3.Prefix, page *yts3.ListBucketVersionsPage) (*yts3.ListBucketVersionsResult, error) {
+	if _, err := db.GetBucket(publicKey, bucketName); err != nil {
+		return nil, err
+	}
+	c := api.GetClient(publicKey)
+	if c == nil {
+		return nil, yts3.ResourceError(yts3.ErrInvalidAccessKeyID, "YTA"+publicKey)
+	}
+	if prefix == nil {
+		prefix = emptyPrefix
+	}
+	owner := &yts3.UserInfo{
+		ID:          c.Username,
+		DisplayName: c.Username,
+	}
+	return listBucketVersions(&clientVersions{db: db, c: c, bucketName: bucketName}, bucketName, owner, prefix, page)
+}
+
+// versionLister is where ListBucketVersions reads the versions of a bucket
+// from.
+type versionLister interface {
+	// listVersions returns up to limit versions of the keys that start with
+	// prefix, in order, starting with the version startVersion of startFile,
+	// or with the first version of startFile if it is the nil ObjectID.
+	listVersions(prefix, startFile string, startVersion primitive.ObjectID, limit uint32) ([]*api.ObjectItem, error)
+
+	// currentVersion returns the VersionId of the latest version of an
+	// object, or the nil ObjectID if it has none.
+	currentVersion(objectName string) (primitive.ObjectID, error)
+}
+
+// clientVersions lists the versions of a bucket through the client of its
+// owner.
+type clientVersions struct {
+	db         *Backend
+	c          *api.Client
+	bucketName string
+}
+
+func (v *clientVersions) listVersions(prefix, startFile string, startVersion primitive.ObjectID, limit uint32) ([]*api.ObjectItem, error) {
+	items, errMsg := v.c.NewObjectAccessor().ListObject(v.bucketName, startFile, prefix, true, startVersion, limit)
+	if errMsg != nil {
+		logrus.Errorf("[ListVersions]/%s,ListObject ERR:%s\n", v.bucketName, errMsg)
+		return nil, pkt.ToError(errMsg)
+	}
+	return items, nil
+}
+
+func (v *clientVersions) currentVersion(objectName string) (primitive.ObjectID, error) {
+	return v.db.currentVersion(v.c, v.bucketName, objectName)
+}
+
+// listBucketVersions returns the page of versions of the bucket that page
+// asks for.
+func listBucketVersions(lister versionLister, bucketName string, owner *yts3.UserInfo, prefix *yts3.Prefix, page *yts3.ListBucketVersionsPage) (*yts3.ListBucketVersionsResult, error) {
+	startVersion := primitive.NilObjectID
+	if page.HasVersionIDMarker {
+		v, err := parseVersionID(page.VersionIDMarker)
+		if err != nil {
+			return nil, err
+		}
+		startVersion = v
+	}
+	pfix := ""
+	if prefix.HasPrefix {
+		pfix = prefix.Prefix
+	}
+	result := yts3.NewListBucketVersionsResult(bucketName, prefix, page)
+	if page.MaxKeys <= 0 {
+		return result, nil
+	}
+	// The versions of the marker key before the version marker were listed
+	// by the previous pages.
+	continued := ""
+	if page.HasKeyMarker && page.HasVersionIDMarker {
+		continued = page.KeyMarker
+	}
+	// Versions that roll up into a common prefix are reported once, and the
+	// versions of the marker key may all be skipped, so a page can take
+	// several batches to fill.
+	var (
+		count         int64
+		lastEntry     string
+		lastVersion   yts3.VersionID
+		lastPrefix    string
+		lastFile      string
+		exhausted     bool
+		match         yts3.PrefixMatch
+		versions      []*yts3.Version
+		newest        = make(map[string]primitive.ObjectID)
+		startFile     = page.KeyMarker
+		resumeFile    = page.KeyMarker
+		resumeVersion = startVersion
+	)
+	// The listing starts with the item it is resumed from, so one more item
+	// than the page holds is asked for to make progress past it.
+	batch := page.MaxKeys + 1
+	for {
+		items, err := lister.listVersions(pfix, startFile, startVersion, uint32(batch))
+		if err != nil {
+			return nil, err
+		}
+		logrus.Infof("[ListVersions]Response %d items\n", len(items))
+		for _, v := range items {
+			if v.FileName == resumeFile && v.VersionId == resumeVersion {
+				continue
+			}
+			lastFile = v.FileName
+			if v.VersionId.Hex() > newest[v.FileName].Hex() {
+				newest[v.FileName] = v.VersionId
+			}
+			if !prefix.Match(v.FileName, &match) {
+				continue
+			}
+			entry := v.FileName
+			if match.CommonPrefix {
+				entry = match.MatchedPart
+				if entry == lastPrefix {
+					continue
+				}
+			}
+			if page.HasKeyMarker && (entry < page.KeyMarker || (entry == page.KeyMarker && continued == "")) {
+				if match.CommonPrefix {
+					lastPrefix = entry
+				}
+				continue
+			}
+			if count >= page.MaxKeys {
+				result.IsTruncated = true
+				break
+			}
+			count++
+			lastEntry, lastVersion = entry, ""
+			if match.CommonPrefix {
+				result.AddPrefix(entry)
+				lastPrefix = entry
+				continue
+			}
+			lastVersion = yts3.VersionID(v.VersionId.Hex())
+			meta, err := api.BytesToFileMetaMap(v.Meta, v.VersionId)
+			if err != nil {
+				logrus.Warnf("[ListVersions]ERR meta,filename:%s\n", v.FileName)
+				continue
+			}
+			content := getContentByMeta(meta)
+			versions = append(versions, &yts3.Version{
+				Key:          v.FileName,
+				VersionID:    lastVersion,
+				LastModified: yts3.NewContentTime(v.VersionId.Timestamp()),
+				Size:         content.Size,
+				StorageClass: yts3.StorageStandard,
+				ETag:         `"` + content.ETag + `"`,
+				Owner:        owner,
+			})
+		}
+		if result.IsTruncated {
+			break
+		}
+		if int64(len(items)) < batch {
+			exhausted = true
+			break
+		}
+		last := items[len(items)-1]
+		nextFile, nextVersion := last.FileName, last.VersionId
+		if lastPrefix != "" && strings.HasPrefix(nextFile, lastPrefix) {
+			nextFile, nextVersion = lastPrefix+skipPrefix, primitive.NilObjectID
+		}
+		if nextFile == startFile && nextVersion == startVersion {
+			logrus.Warnf("[ListVersions]%s,listing does not advance past %s\n", bucketName, startFile)
+			break
+		}
+		startFile, startVersion = nextFile, nextVersion
+		resumeFile, resumeVersion = nextFile, nextVersion
+	}
+	// Every version of a key listed in full is on hand, and the latest one
+	// is the newest of them. Only the keys cut off by the markers of this
+	// page or the next one are looked up.
+	latest := make(map[string]primitive.ObjectID)
+	for _, v := range versions {
+		result.Versions = append(result.Versions, v)
+		current, ok := latest[v.Key]
+		if !ok {
+			if v.Key != continued && (exhausted || v.Key != lastFile) {
+				current = newest[v.Key]
+			} else {
+				var err error
+				if current, err = lister.currentVersion(v.Key); err != nil {
+					logrus.Errorf("[ListVersions]/%s/%s,latest version ERR:%s\n", bucketName, v.Key, err)
+					return nil, err
+				}
+			}
+			latest[v.Key] = current
+		}
+		v.IsLatest = string(v.VersionID) == current.Hex()
+	}
+	if result.IsTruncated {
+		result.NextKeyMarker = lastEntry
+		result.NextVersionIDMarker = lastVersion
+	}
+	return result, nil
+}
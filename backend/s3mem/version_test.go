@@ -0,0 +1,258 @@
+package s3mem
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/yottachain/YTCoreService/api"
+	"github.com/yottachain/YTS3/yts3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeVersions is a bucket listed in key order, and in version order within
+// a key.
+type fakeVersions struct {
+	items   []*api.ObjectItem
+	lists   int
+	lookups []string
+}
+
+func newFakeVersions(t *testing.T, keys map[string]int) *fakeVersions {
+	var names []string
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	f := &fakeVersions{}
+	n := 0
+	for _, name := range names {
+		for i := 0; i < keys[name]; i++ {
+			n++
+			id, err := primitive.ObjectIDFromHex(fmt.Sprintf("%024x", n))
+			if err != nil {
+				t.Fatal(err)
+			}
+			meta, err := api.FileMetaMapTobytes(map[string]string{"ETag": "etag"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.items = append(f.items, &api.ObjectItem{FileName: name, VersionId: id, Meta: meta})
+		}
+	}
+	return f
+}
+
+func (f *fakeVersions) listVersions(prefix, startFile string, startVersion primitive.ObjectID, limit uint32) ([]*api.ObjectItem, error) {
+	f.lists++
+	var items []*api.ObjectItem
+	for _, item := range f.items {
+		if !strings.HasPrefix(item.FileName, prefix) || item.FileName < startFile {
+			continue
+		}
+		if item.FileName == startFile && item.VersionId.Hex() < startVersion.Hex() {
+			continue
+		}
+		if uint32(len(items)) == limit {
+			break
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (f *fakeVersions) currentVersion(objectName string) (primitive.ObjectID, error) {
+	f.lookups = append(f.lookups, objectName)
+	current := primitive.NilObjectID
+	for _, item := range f.items {
+		if item.FileName == objectName {
+			current = item.VersionId
+		}
+	}
+	return current, nil
+}
+
+// latest returns the newest version of each key.
+func (f *fakeVersions) latest() map[string]yts3.VersionID {
+	latest := make(map[string]yts3.VersionID)
+	for _, item := range f.items {
+		latest[item.FileName] = yts3.VersionID(item.VersionId.Hex())
+	}
+	return latest
+}
+
+// listPage lists a page and checks the latest versions it reports. It
+// returns the page as "key@version" for versions and "prefix/" for common
+// prefixes.
+func (f *fakeVersions) listPage(t *testing.T, prefix *yts3.Prefix, page *yts3.ListBucketVersionsPage) ([]string, *yts3.ListBucketVersionsResult) {
+	t.Helper()
+	result, err := listBucketVersions(f, "bucket", &yts3.UserInfo{ID: "owner"}, prefix, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := f.latest()
+	var entries []string
+	for _, item := range result.Versions {
+		v := item.(*yts3.Version)
+		if v.IsLatest != (latest[v.Key] == v.VersionID) {
+			t.Errorf("%s@%s: expected latest %v", v.Key, v.VersionID, !v.IsLatest)
+		}
+		entries = append(entries, fmt.Sprintf("%s@%d", v.Key, versionNumber(v.VersionID)))
+	}
+	for _, p := range result.CommonPrefixes {
+		entries = append(entries, p.Prefix)
+	}
+	return entries, result
+}
+
+func versionNumber(v yts3.VersionID) int {
+	var n int
+	fmt.Sscanf(string(v), "%x", &n)
+	return n
+}
+
+func versionMarker(n int) yts3.VersionID {
+	return yts3.VersionID(fmt.Sprintf("%024x", n))
+}
+
+var versionedKeys = map[string]int{"a": 2, "b": 1, "dir/c": 2, "dir/d": 1, "e": 3}
+
+func TestListBucketVersions(t *testing.T) {
+	delimited := &yts3.Prefix{HasDelimiter: true, Delimiter: "/"}
+	for _, tc := range []struct {
+		name      string
+		prefix    *yts3.Prefix
+		page      yts3.ListBucketVersionsPage
+		entries   string
+		truncated bool
+		next      string
+	}{
+		{"all", emptyPrefix, yts3.ListBucketVersionsPage{MaxKeys: 100}, "[a@1 a@2 b@3 dir/c@4 dir/c@5 dir/d@6 e@7 e@8 e@9]", false, ""},
+		{"exactly full", emptyPrefix, yts3.ListBucketVersionsPage{MaxKeys: 9}, "[a@1 a@2 b@3 dir/c@4 dir/c@5 dir/d@6 e@7 e@8 e@9]", false, ""},
+		{"one short", emptyPrefix, yts3.ListBucketVersionsPage{MaxKeys: 8}, "[a@1 a@2 b@3 dir/c@4 dir/c@5 dir/d@6 e@7 e@8]", true, "e@8"},
+		{"no keys", emptyPrefix, yts3.ListBucketVersionsPage{MaxKeys: 0}, "[]", false, ""},
+		{"prefix", &yts3.Prefix{HasPrefix: true, Prefix: "dir/"}, yts3.ListBucketVersionsPage{MaxKeys: 100}, "[dir/c@4 dir/c@5 dir/d@6]", false, ""},
+		{"delimiter", delimited, yts3.ListBucketVersionsPage{MaxKeys: 100}, "[a@1 a@2 b@3 e@7 e@8 e@9 dir/]", false, ""},
+		{"delimiter cut at prefix", delimited, yts3.ListBucketVersionsPage{MaxKeys: 4}, "[a@1 a@2 b@3 dir/]", true, "dir/@0"},
+		{"key marker", emptyPrefix, yts3.ListBucketVersionsPage{MaxKeys: 3, KeyMarker: "a", HasKeyMarker: true}, "[b@3 dir/c@4 dir/c@5]", true, "dir/c@5"},
+		{"key marker between keys", emptyPrefix, yts3.ListBucketVersionsPage{MaxKeys: 100, KeyMarker: "c", HasKeyMarker: true}, "[dir/c@4 dir/c@5 dir/d@6 e@7 e@8 e@9]", false, ""},
+		{"key marker on the last key", emptyPrefix, yts3.ListBucketVersionsPage{MaxKeys: 100, KeyMarker: "e", HasKeyMarker: true}, "[]", false, ""},
+		{"key marker past the end", emptyPrefix, yts3.ListBucketVersionsPage{MaxKeys: 100, KeyMarker: "z", HasKeyMarker: true}, "[]", false, ""},
+		{"key marker on a prefix", delimited, yts3.ListBucketVersionsPage{MaxKeys: 100, KeyMarker: "dir/", HasKeyMarker: true}, "[e@7 e@8 e@9]", false, ""},
+		{"version marker", emptyPrefix, yts3.ListBucketVersionsPage{MaxKeys: 2, KeyMarker: "e", HasKeyMarker: true, VersionIDMarker: versionMarker(7), HasVersionIDMarker: true}, "[e@8 e@9]", false, ""},
+		{"version marker cut", emptyPrefix, yts3.ListBucketVersionsPage{MaxKeys: 1, KeyMarker: "a", HasKeyMarker: true, VersionIDMarker: versionMarker(1), HasVersionIDMarker: true}, "[a@2]", true, "a@2"},
+		{"last version marker", emptyPrefix, yts3.ListBucketVersionsPage{MaxKeys: 100, KeyMarker: "e", HasKeyMarker: true, VersionIDMarker: versionMarker(9), HasVersionIDMarker: true}, "[]", false, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeVersions(t, versionedKeys)
+			entries, result := f.listPage(t, tc.prefix, &tc.page)
+			if fmt.Sprint(entries) != tc.entries {
+				t.Fatalf("expected %s, got %v", tc.entries, entries)
+			}
+			if result.IsTruncated != tc.truncated {
+				t.Fatalf("expected truncated %v, got %v", tc.truncated, result.IsTruncated)
+			}
+			next := ""
+			if result.IsTruncated {
+				next = fmt.Sprintf("%s@%d", result.NextKeyMarker, versionNumber(result.NextVersionIDMarker))
+			}
+			if next != tc.next {
+				t.Fatalf("expected next marker %s, got %s", tc.next, next)
+			}
+		})
+	}
+
+	if _, err := listBucketVersions(newFakeVersions(t, versionedKeys), "bucket", nil, emptyPrefix, &yts3.ListBucketVersionsPage{
+		MaxKeys: 100, KeyMarker: "a", HasKeyMarker: true, VersionIDMarker: "null", HasVersionIDMarker: true,
+	}); err == nil {
+		t.Fatal("expected an invalid version marker to fail")
+	}
+}
+
+func TestListBucketVersionsPages(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		prefix *yts3.Prefix
+		all    string
+	}{
+		{"versions", emptyPrefix, "[a@1 a@2 b@3 dir/c@4 dir/c@5 dir/d@6 e@7 e@8 e@9]"},
+		{"prefixes", &yts3.Prefix{HasDelimiter: true, Delimiter: "/"}, "[a@1 a@2 b@3 dir/ e@7 e@8 e@9]"},
+	} {
+		for maxKeys := int64(1); maxKeys <= 10; maxKeys++ {
+			t.Run(fmt.Sprintf("%s by %d", tc.name, maxKeys), func(t *testing.T) {
+				f := newFakeVersions(t, versionedKeys)
+				page := yts3.ListBucketVersionsPage{MaxKeys: maxKeys}
+				var all []string
+				for pages := 0; ; pages++ {
+					if pages > 10 {
+						t.Fatal("the listing does not end")
+					}
+					entries, result := f.listPage(t, tc.prefix, &page)
+					if int64(len(entries)) > maxKeys {
+						t.Fatalf("page of %d entries, expected at most %d", len(entries), maxKeys)
+					}
+					// Common prefixes are listed after the versions of a page.
+					sort.SliceStable(entries, func(i, j int) bool { return entryKey(entries[i]) < entryKey(entries[j]) })
+					all = append(all, entries...)
+					if !result.IsTruncated {
+						if len(entries) == 0 && pages > 0 {
+							t.Fatal("the last page is empty; the one before should not have been truncated")
+						}
+						break
+					}
+					page.KeyMarker, page.HasKeyMarker = result.NextKeyMarker, true
+					page.VersionIDMarker = result.NextVersionIDMarker
+					page.HasVersionIDMarker = result.NextVersionIDMarker != ""
+				}
+				if fmt.Sprint(all) != tc.all {
+					t.Fatalf("expected %s, got %v", tc.all, all)
+				}
+			})
+		}
+	}
+}
+
+func entryKey(entry string) string {
+	return strings.SplitN(entry, "@", 2)[0]
+}
+
+func TestListBucketVersionsLatest(t *testing.T) {
+	// The latest version of a key listed in full is known from the listing;
+	// only the keys cut off by the markers are looked up.
+	f := newFakeVersions(t, versionedKeys)
+	f.listPage(t, emptyPrefix, &yts3.ListBucketVersionsPage{MaxKeys: 100})
+	if len(f.lookups) != 0 {
+		t.Fatalf("expected no lookups, got %v", f.lookups)
+	}
+
+	f = newFakeVersions(t, versionedKeys)
+	f.listPage(t, emptyPrefix, &yts3.ListBucketVersionsPage{MaxKeys: 4})
+	if fmt.Sprint(f.lookups) != "[dir/c]" {
+		t.Fatalf("page cut in dir/c: expected [dir/c] looked up, got %v", f.lookups)
+	}
+
+	f = newFakeVersions(t, versionedKeys)
+	f.listPage(t, emptyPrefix, &yts3.ListBucketVersionsPage{MaxKeys: 100, KeyMarker: "e", HasKeyMarker: true, VersionIDMarker: versionMarker(7), HasVersionIDMarker: true})
+	if fmt.Sprint(f.lookups) != "[e]" {
+		t.Fatalf("page resumed in e: expected [e] looked up, got %v", f.lookups)
+	}
+}
+
+func TestListBucketVersionsSkipsPrefix(t *testing.T) {
+	// The versions under a common prefix are skipped in one step, not read
+	// batch by batch.
+	f := newFakeVersions(t, map[string]int{"a": 1, "dir/x": 500, "dir/y": 500, "z": 1})
+	entries, result := f.listPage(t, &yts3.Prefix{HasDelimiter: true, Delimiter: "/"}, &yts3.ListBucketVersionsPage{MaxKeys: 2})
+	if fmt.Sprint(entries) != "[a@1 dir/]" || !result.IsTruncated {
+		t.Fatalf("expected [a@1 dir/] truncated, got %v truncated %v", entries, result.IsTruncated)
+	}
+	f.lists = 0
+	entries, result = f.listPage(t, &yts3.Prefix{HasDelimiter: true, Delimiter: "/"}, &yts3.ListBucketVersionsPage{MaxKeys: 2, KeyMarker: result.NextKeyMarker, HasKeyMarker: true})
+	if fmt.Sprint(entries) != "[z@1002]" || result.IsTruncated {
+		t.Fatalf("expected [z@1002], got %v truncated %v", entries, result.IsTruncated)
+	}
+	if f.lists > 2 {
+		t.Fatalf("expected at most 2 listings, got %d", f.lists)
+	}
+}
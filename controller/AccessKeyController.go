@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/yottachain/YTCoreService/api"
+	"github.com/yottachain/YTCoreService/env"
+	"github.com/yottachain/YTS3/credential"
+)
+
+//adminRequest 只允许本机调用access key管理接口
+func adminRequest(g *gin.Context) bool {
+	host, _, err := net.SplitHostPort(g.Request.RemoteAddr)
+	if err == nil {
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return true
+		}
+	}
+	logrus.Warnf("[AccessKey]Reject admin request from %s\n", g.Request.RemoteAddr)
+	g.JSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden, "Msg": "access key admin API is only available on localhost"})
+	return false
+}
+
+//CreateAccessKey 为用户生成access key/secret key
+func CreateAccessKey(g *gin.Context) {
+	defer env.TracePanic("CreateAccessKey")
+	if !adminRequest(g) {
+		return
+	}
+	userName := g.Request.FormValue("userName")
+	publicKey := g.Request.FormValue("publicKey")
+	if userName == "" || publicKey == "" {
+		g.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "Msg": "userName or publicKey is empty"})
+		return
+	}
+	if c := api.GetClient(strings.TrimPrefix(publicKey, "YTA")); c == nil || c.Username != userName {
+		g.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "Msg": "user " + userName + " is not registered with this public key"})
+		return
+	}
+	key, err := credential.Keys.Create(userName, publicKey)
+	if err != nil {
+		logrus.Errorf("[AccessKey]Create err:%s\n", err)
+		g.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError, "Msg": err.Error()})
+		return
+	}
+	g.JSON(http.StatusOK, key)
+}
+
+//ListAccessKeys 列出用户的access key,不返回secret key
+func ListAccessKeys(g *gin.Context) {
+	defer env.TracePanic("ListAccessKeys")
+	if !adminRequest(g) {
+		return
+	}
+	keys := credential.Keys.List(g.Query("userName"))
+	for _, k := range keys {
+		k.SecretKey = ""
+	}
+	g.JSON(http.StatusOK, keys)
+}
+
+//DisableAccessKey 停用access key
+func DisableAccessKey(g *gin.Context) {
+	setAccessKeyDisabled(g, true)
+}
+
+//EnableAccessKey 启用access key
+func EnableAccessKey(g *gin.Context) {
+	setAccessKeyDisabled(g, false)
+}
+
+func setAccessKeyDisabled(g *gin.Context, disabled bool) {
+	defer env.TracePanic("setAccessKeyDisabled")
+	if !adminRequest(g) {
+		return
+	}
+	accessKey := g.Request.FormValue("accessKey")
+	if err := credential.Keys.SetDisabled(accessKey, disabled); err != nil {
+		accessKeyError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "Msg": accessKey})
+}
+
+//DeleteAccessKey 删除access key
+func DeleteAccessKey(g *gin.Context) {
+	defer env.TracePanic("DeleteAccessKey")
+	if !adminRequest(g) {
+		return
+	}
+	accessKey := g.Request.FormValue("accessKey")
+	if err := credential.Keys.Delete(accessKey); err != nil {
+		accessKeyError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "Msg": accessKey})
+}
+
+func accessKeyError(g *gin.Context, err error) {
+	if err == credential.ErrNoSuchAccessKey {
+		g.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "Msg": err.Error()})
+		return
+	}
+	logrus.Errorf("[AccessKey]Update err:%s\n", err)
+	g.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError, "Msg": err.Error()})
+}
@@ -88,7 +88,9 @@ func Register(g *gin.Context) {
 			return
 		}
 		logrus.Infof("[Register]User Register Success,UserName: %s\n", userName)
-		g.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "Msg": "Register success " + userName})
+		//返回旧式访问密钥,其SecretKey由私钥派生,S3客户端无需配置私钥
+		g.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "Msg": "Register success " + userName,
+			"AccessKey": "YTA" + client.SignKey.PublicKey, "SecretKey": s3mem.LegacySecretKey(client.SignKey.PrivateKey)})
 	}
 }
 
@@ -0,0 +1,260 @@
+package credential
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yottachain/YTCoreService/env"
+	"github.com/yottachain/YTS3/yts3"
+)
+
+// AccessKeyPrefix starts every generated access key. It keeps them apart from
+// the legacy "YTA<publicKey>" access keys.
+const AccessKeyPrefix = "YTK"
+
+var ErrNoSuchAccessKey = errors.New("access key does not exist")
+
+// Key maps an S3 access key/secret key pair to a YottaChain user.
+type Key struct {
+	AccessKey string    `json:"accessKey"`
+	SecretKey string    `json:"secretKey"`
+	UserName  string    `json:"userName"`
+	PublicKey string    `json:"publicKey"`
+	Disabled  bool      `json:"disabled"`
+	Created   time.Time `json:"created"`
+}
+
+// Store keeps the access keys in a JSON file. Changes made to the file by
+// another process (e.g. the "accesskey" command) are picked up on the next
+// lookup.
+type Store struct {
+	path    string
+	modTime time.Time
+	keys    map[string]*Key
+	mu      sync.RWMutex
+}
+
+var _ yts3.CredentialProvider = &Store{}
+
+// Keys is the store used by the gateway; it is opened by InitStore.
+var Keys *Store
+
+// InitStore opens the access key file configured with "AccessKeyFile",
+// which defaults to conf/accesskeys.json under the YTFS home.
+func InitStore() error {
+	path := env.GetConfig().GetString("AccessKeyFile", env.YTFS_HOME+"conf/accesskeys.json")
+	s, err := Open(path)
+	if err != nil {
+		return err
+	}
+	Keys = s
+	return nil
+}
+
+// Open loads the store at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, keys: map[string]*Key{}}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) load() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var list []*Key
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	keys := make(map[string]*Key, len(list))
+	for _, k := range list {
+		keys[k.AccessKey] = k
+	}
+	s.keys = keys
+	s.modTime = info.ModTime()
+	return nil
+}
+
+func (s *Store) reloadIfChanged() {
+	s.mu.RLock()
+	info, err := os.Stat(s.path)
+	changed := err == nil && !info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+	if !changed {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		logrus.Errorf("[AccessKey]Reload %s err:%s\n", s.path, err)
+	}
+}
+
+func (s *Store) save() error {
+	list := make([]*Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].AccessKey < list[j].AccessKey })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// Create generates a new key pair for the user. A user may have any number
+// of keys.
+func (s *Store) Create(userName, publicKey string) (*Key, error) {
+	publicKey = strings.TrimPrefix(publicKey, "YTA")
+	if userName == "" || publicKey == "" {
+		return nil, errors.New("userName and publicKey are required")
+	}
+	s.reloadIfChanged()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := &Key{
+		UserName:  userName,
+		PublicKey: publicKey,
+		Created:   time.Now(),
+	}
+	for {
+		key.AccessKey = AccessKeyPrefix + base32.StdEncoding.EncodeToString(randomBytes(15))[:17]
+		if _, ok := s.keys[key.AccessKey]; !ok {
+			break
+		}
+	}
+	key.SecretKey = base64.StdEncoding.EncodeToString(randomBytes(30))
+	s.keys[key.AccessKey] = key
+	if err := s.save(); err != nil {
+		delete(s.keys, key.AccessKey)
+		return nil, err
+	}
+	logrus.Infof("[AccessKey]Created %s for user %s\n", key.AccessKey, userName)
+	copied := *key
+	return &copied, nil
+}
+
+// Get returns a copy of the key with the given access key id.
+func (s *Store) Get(accessKey string) (*Key, bool) {
+	s.reloadIfChanged()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[accessKey]
+	if !ok {
+		return nil, false
+	}
+	copied := *k
+	return &copied, true
+}
+
+// List returns the keys of a user, or every key if userName is empty.
+func (s *Store) List(userName string) []*Key {
+	s.reloadIfChanged()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*Key
+	for _, k := range s.keys {
+		if userName == "" || k.UserName == userName {
+			copied := *k
+			out = append(out, &copied)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AccessKey < out[j].AccessKey })
+	return out
+}
+
+// SetDisabled disables or re-enables a key. Requests signed with a disabled
+// key are rejected.
+func (s *Store) SetDisabled(accessKey string, disabled bool) error {
+	s.reloadIfChanged()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[accessKey]
+	if !ok {
+		return ErrNoSuchAccessKey
+	}
+	old := k.Disabled
+	k.Disabled = disabled
+	if err := s.save(); err != nil {
+		k.Disabled = old
+		return err
+	}
+	logrus.Infof("[AccessKey]%s disabled:%v\n", accessKey, disabled)
+	return nil
+}
+
+// Delete removes a key for good.
+func (s *Store) Delete(accessKey string) error {
+	s.reloadIfChanged()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[accessKey]
+	if !ok {
+		return ErrNoSuchAccessKey
+	}
+	delete(s.keys, accessKey)
+	if err := s.save(); err != nil {
+		s.keys[accessKey] = k
+		return err
+	}
+	logrus.Infof("[AccessKey]Deleted %s\n", accessKey)
+	return nil
+}
+
+// Credential implements yts3.CredentialProvider.
+func (s *Store) Credential(accessKeyID string) (*yts3.Credential, error) {
+	k, ok := s.Get(accessKeyID)
+	if !ok {
+		return nil, yts3.ResourceError(yts3.ErrInvalidAccessKeyID, accessKeyID)
+	}
+	if k.Disabled {
+		return nil, yts3.ErrorMessage(yts3.ErrAccessDenied, "the access key is disabled")
+	}
+	return &yts3.Credential{
+		AccessKey: k.AccessKey,
+		SecretKey: k.SecretKey,
+		PublicKey: k.PublicKey,
+	}, nil
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
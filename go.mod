@@ -3,6 +3,7 @@ module github.com/yottachain/YTS3
 go 1.17
 
 require (
+	github.com/boltdb/bolt v1.3.1
 	github.com/gin-contrib/cors v1.3.1
 	github.com/gin-gonic/gin v1.6.3
 	github.com/go-ini/ini v1.57.0
@@ -20,7 +21,6 @@ require (
 	github.com/BurntSushi/toml v0.3.1 // indirect
 	github.com/aurawing/auramq v0.0.2-0.20200521072017-845ffa488ac8 // indirect
 	github.com/aurawing/eos-go v0.9.1-0.20200517054114-c338bd5d1974 // indirect
-	github.com/boltdb/bolt v1.3.1 // indirect
 	github.com/btcsuite/btcd v0.20.1-beta // indirect
 	github.com/ethereum/go-ethereum v1.9.9 // indirect
 	github.com/fastly/go-utils v0.0.0-20180712184237-d95a45783239 // indirect
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	httppprof "net/http/pprof"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
 	"strconv"
 	"time"
@@ -20,6 +21,7 @@ import (
 	"github.com/yottachain/YTCoreService/api"
 	"github.com/yottachain/YTCoreService/env"
 	"github.com/yottachain/YTS3/backend/s3mem"
+	"github.com/yottachain/YTS3/credential"
 	"github.com/yottachain/YTS3/routers"
 	"github.com/yottachain/YTS3/yts3"
 )
@@ -64,6 +66,10 @@ func main() {
 			fmt.Println(env.Version)
 			return
 		}
+		if cmd == "accesskey" {
+			accessKeyCommand(os.Args[2:])
+			return
+		}
 		if cmd == "console" {
 			env.Console = true
 			err = s.Run()
@@ -125,6 +131,7 @@ func main() {
 		logger.Info("restart      Restart if running as a daemon or in another console.")
 		logger.Info("install      Install to start automatically when system boots.")
 		logger.Info("uninstall    Uninstall.")
+		logger.Info("accesskey    Manage S3 access keys: create <userName> <publicKey> | list [userName] | disable|enable|delete <accessKey>.")
 		return
 	}
 	err = s.Run()
@@ -137,6 +144,45 @@ func s3StopServer() {
 
 }
 
+func accessKeyCommand(args []string) {
+	if err := credential.InitStore(); err != nil {
+		fmt.Println("Open access key store err:", err)
+		return
+	}
+	if len(args) == 0 {
+		fmt.Println("Usage: accesskey create <userName> <publicKey> | list [userName] | disable|enable|delete <accessKey>")
+		return
+	}
+	var err error
+	switch {
+	case args[0] == "create" && len(args) == 3:
+		var key *credential.Key
+		if key, err = credential.Keys.Create(args[1], args[2]); err == nil {
+			fmt.Printf("AccessKey: %s\nSecretKey: %s\n", key.AccessKey, key.SecretKey)
+		}
+	case args[0] == "list" && len(args) <= 2:
+		userName := ""
+		if len(args) == 2 {
+			userName = args[1]
+		}
+		for _, key := range credential.Keys.List(userName) {
+			fmt.Printf("%s\t%s\tYTA%s\tdisabled:%v\n", key.AccessKey, key.UserName, key.PublicKey, key.Disabled)
+		}
+	case args[0] == "disable" && len(args) == 2:
+		err = credential.Keys.SetDisabled(args[1], true)
+	case args[0] == "enable" && len(args) == 2:
+		err = credential.Keys.SetDisabled(args[1], false)
+	case args[0] == "delete" && len(args) == 2:
+		err = credential.Keys.Delete(args[1])
+	default:
+		fmt.Println("Usage: accesskey create <userName> <publicKey> | list [userName] | disable|enable|delete <accessKey>")
+		return
+	}
+	if err != nil {
+		fmt.Println("accesskey", args[0], "err:", err)
+	}
+}
+
 var crt, key string
 
 func s3StartServer() {
@@ -162,6 +208,9 @@ func s3StartServer() {
 
 	api.StartApi()
 	s3mem.InitObjectUpPool()
+	if err := credential.InitStore(); err != nil {
+		logrus.Fatalf("[Main]Open access key store err:%s\n", err)
+	}
 	crt = env.YTFS_HOME + "crt/server.crt"
 	key = env.YTFS_HOME + "crt/server.key"
 	_, err := ioutil.ReadFile(crt)
@@ -197,6 +246,7 @@ type yts3Flags struct {
 	initialBucket string
 	fixedTimeStr  string
 	noIntegrity   bool
+	noAuth        bool
 	hostBucket    bool
 
 	boltDb         string
@@ -215,6 +265,7 @@ func (f *yts3Flags) attach(flagSet *flag.FlagSet) {
 	flagSet.StringVar(&f.fixedTimeStr, "time", "", "RFC3339 format. If passed, the server's clock will always see this time; does not affect existing stored dates.")
 	flagSet.StringVar(&f.initialBucket, "initialbucket", "", "If passed, this bucket will be created on startup if it does not already exist.")
 	flagSet.BoolVar(&f.noIntegrity, "no-integrity", false, "Pass this flag to disable Content-MD5 validation when uploading.")
+	flagSet.BoolVar(&f.noAuth, "no-auth", false, "Pass this flag to disable AWS signature verification of requests.")
 	flagSet.BoolVar(&f.hostBucket, "hostbucket", false, "If passed, the bucket name will be extracted from the first segment of the hostname, rather than the first part of the URL path.")
 	flagSet.StringVar(&f.initialBucket, "bucket", "", `Deprecated; use -initialbucket`)
 
@@ -292,12 +343,32 @@ func run() error {
 	}
 	if values.initialBucket != "" {
 	}
+	var credentials yts3.CredentialProvider
+	if !values.noAuth {
+		// Generated access keys first, then the legacy "YTA<publicKey>" keys.
+		if legacy, ok := backend.(yts3.CredentialProvider); ok {
+			credentials = yts3.MultiCredentialProvider(credential.Keys, legacy)
+		} else {
+			credentials = credential.Keys
+		}
+	}
+	registry, err := yts3.OpenUploadRegistry(env.GetConfig().GetString("UploadRegistry", filepath.Join(env.GetS3Cache(), "_uploads.db")))
+	if err != nil {
+		return fmt.Errorf("open multipart upload registry: %w", err)
+	}
+	defer registry.Close()
 	faker := yts3.New(backend,
 		yts3.WithIntegrityCheck(!values.noIntegrity),
 		yts3.WithTimeSkewLimit(timeSkewLimit),
 		yts3.WithTimeSource(timeSource),
 		yts3.WithLogger(yts3.GlobalLog()),
 		yts3.WithHostBucket(values.hostBucket),
+		yts3.WithCredentialProvider(credentials),
+		yts3.WithUploadRegistry(registry),
+		yts3.WithUploadReaper(
+			time.Duration(env.GetConfig().GetInt("MultipartExpireHours", 168))*time.Hour,
+			time.Duration(env.GetConfig().GetInt("MultipartReapMinutes", 60))*time.Minute),
+		yts3.WithMaxRanges(env.GetConfig().GetInt("MaxRanges", yts3.DefaultMaxRanges)),
 	)
 	return listenAndServe(values.host, faker.Server())
 }
@@ -58,6 +58,11 @@ func InitRouter() (router *gin.Engine) {
 		v1.GET("/licensedTo", controller.LicensedTo)
 		v1.POST("/saveFileToLocal", controller.SaveFileToLocal)
 		v1.POST("/account/create", controller.CreateAccountCli)
+		v1.POST("/accessKey/create", controller.CreateAccessKey)
+		v1.GET("/accessKey/list", controller.ListAccessKeys)
+		v1.POST("/accessKey/disable", controller.DisableAccessKey)
+		v1.POST("/accessKey/enable", controller.EnableAccessKey)
+		v1.POST("/accessKey/delete", controller.DeleteAccessKey)
 		//v1.GET("/addClientforMobile", controller.AddClientforMobile)
 	}
 
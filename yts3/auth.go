@@ -0,0 +1,175 @@
+package yts3
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Identity is the caller a request has been authenticated as.
+type Identity struct {
+	// AccessKey is the access key id the request was signed with.
+	AccessKey string
+
+	// PublicKey is the YottaChain public key (without the "YTA" prefix)
+	// that is passed to the Backend.
+	PublicKey string
+}
+
+// Authenticator resolves the caller of a request. It is run once per request
+// by Yts3.Server() before routing; handlers read the result back with
+// IdentityFromContext.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// Credential is a signing key pair and the YottaChain user it belongs to.
+type Credential struct {
+	AccessKey string
+	SecretKey string
+	PublicKey string
+}
+
+// CredentialProvider looks up the Credential of an access key id. The secret
+// is never sent over the wire; it is only used to derive the signing key the
+// client must have used. Unknown access keys are reported with
+// ErrInvalidAccessKeyID.
+type CredentialProvider interface {
+	Credential(accessKeyID string) (*Credential, error)
+}
+
+// MultiCredentialProvider asks each provider in turn, moving on to the next
+// one only when an access key is unknown to the previous.
+func MultiCredentialProvider(providers ...CredentialProvider) CredentialProvider {
+	return multiCredentialProvider(providers)
+}
+
+type multiCredentialProvider []CredentialProvider
+
+func (m multiCredentialProvider) Credential(accessKeyID string) (*Credential, error) {
+	for _, p := range m {
+		cred, err := p.Credential(accessKeyID)
+		if !HasErrorCode(err, ErrInvalidAccessKeyID) {
+			return cred, err
+		}
+	}
+	return nil, ResourceError(ErrInvalidAccessKeyID, accessKeyID)
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the Identity the Authenticator placed on the
+// request context, or nil for unauthenticated requests.
+func IdentityFromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+func requestPublicKey(r *http.Request) (string, error) {
+	id := IdentityFromContext(r.Context())
+	if id == nil || id.PublicKey == "" {
+		return "", ErrAuthorization
+	}
+	return id.PublicKey, nil
+}
+
+// NewSignatureAuthenticator verifies AWS Signature V4 and the legacy
+// Signature V2, either from the Authorization header or from presigned URL
+// query parameters. The version is picked from the shape of the header or
+// query. hostBucket must match WithHostBucket: SigV2 signs the bucket as part
+// of the resource even when it is carried in the host name. Requests signed
+// more than skew away from timeSource are rejected, so that a captured
+// request cannot be replayed; a zero skew disables the check.
+func NewSignatureAuthenticator(credentials CredentialProvider, timeSource TimeSource, skew time.Duration, hostBucket bool) Authenticator {
+	return &signatureAuthenticator{credentials: credentials, timeSource: timeSource, skew: skew, hostBucket: hostBucket}
+}
+
+type signatureAuthenticator struct {
+	credentials CredentialProvider
+	timeSource  TimeSource
+	skew        time.Duration
+	hostBucket  bool
+}
+
+func (a *signatureAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	var cred *Credential
+	var err error
+	auth := r.Header.Get("Authorization")
+	query := r.URL.Query()
+	switch {
+	case isSignatureV2(auth):
+		cred, err = verifySignatureV2(r, a.credentials, a.bucket(r), a.timeSource.Now(), a.skew)
+	case auth != "":
+		cred, err = verifySignatureV4(r, a.credentials, a.timeSource.Now(), a.skew)
+	case isPresignedV2(query):
+		cred, err = verifyPresignedV2(r, a.credentials, a.bucket(r), a.timeSource.Now())
+	case isPresignedRequest(query):
+		cred, err = verifyPresignedV4(r, a.credentials, a.timeSource.Now())
+	default:
+		err = ErrAccessDenied
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{AccessKey: cred.AccessKey, PublicKey: cred.PublicKey}, nil
+}
+
+// bucket returns the bucket carried in the host name, if any.
+func (a *signatureAuthenticator) bucket(r *http.Request) string {
+	if !a.hostBucket {
+		return ""
+	}
+	return strings.SplitN(r.Host, ".", 2)[0]
+}
+
+// headerAuthenticator takes the access key from the Authorization header (or
+// the presigned credential) without checking the signature. It is used when
+// no CredentialProvider has been configured.
+type headerAuthenticator struct{}
+
+func (headerAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		auth = r.URL.Query().Get("X-Amz-Credential")
+	}
+	if auth == "" {
+		auth = r.URL.Query().Get("AWSAccessKeyId")
+	}
+	if isSignatureV2(auth) {
+		// "AWS YTA<publicKey>:<signature>"
+		auth = strings.Replace(auth, ":", "/", 1)
+	}
+	accessKey := GetBetweenStr(auth, "YTA", "/")
+	if !strings.HasPrefix(accessKey, "YTA") || len(accessKey) == len("YTA") {
+		return nil, ErrAuthorization
+	}
+	return &Identity{AccessKey: accessKey, PublicKey: PublicKeyFromAccessKey(accessKey)}, nil
+}
+
+func (g *Yts3) authMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		if rq.Method == http.MethodOptions {
+			handler.ServeHTTP(w, rq)
+			return
+		}
+		id, err := g.auth.Authenticate(rq)
+		if err != nil {
+			logrus.Errorf("[Auth]%s %s,authenticate err:%s\n", rq.Method, rq.URL.Path, err)
+			g.httpError(w, rq, err)
+			return
+		}
+		if _, decoded := rq.Body.(*chunkedReader); !decoded && isStreamingPayload(rq) {
+			// The Authenticator did not check the chunk signatures (e.g.
+			// verification is disabled), but the body still has to be decoded.
+			size, err := requestContentLength(rq)
+			if err != nil {
+				size = -1
+			}
+			rq.Body = newChunkedReader(rq.Body, nil, size)
+		}
+		handler.ServeHTTP(w, rq.WithContext(context.WithValue(rq.Context(), identityKey{}, id)))
+	})
+}
@@ -1,6 +1,9 @@
 package yts3
 
-import "io"
+import (
+	"io"
+	"time"
+)
 
 const (
 	DefaultBucketVersionKeys = 1000
@@ -17,6 +20,13 @@ type Object struct {
 	IsDeleteMarker bool
 }
 
+// RangeReader is implemented by the Contents of an Object whose backend can
+// read any byte range of it on demand. It is used to serve requests for
+// several ranges.
+type RangeReader interface {
+	ReadRange(start, length int64) (io.ReadCloser, error)
+}
+
 type ObjectList struct {
 	CommonPrefixes []CommonPrefix
 	Contents       []*Content
@@ -40,13 +50,25 @@ func (p ListBucketPage) IsEmpty() bool {
 	return p == ListBucketPage{}
 }
 
+type ListBucketVersionsPage struct {
+	KeyMarker    string
+	HasKeyMarker bool
+
+	VersionIDMarker    VersionID
+	HasVersionIDMarker bool
+
+	MaxKeys int64
+}
+
 type Backend interface {
 	ListBuckets(publicKey string) ([]BucketInfo, error)
 	ListBucket(publicKey, name string, prefix *Prefix, page ListBucketPage) (*ObjectList, error)
 	CreateBucket(publicKey, name string) error
 	DeleteMulti(publicKey, bucketName string, objects ...string) (MultiDeleteResult, error)
 	PutObject(publicKey, bucketName, key string, meta map[string]string, input io.Reader, size int64) (PutObjectResult, error)
-	MultipartUpload(publicKey, bucketName, objectName string, partsPath []string, size int64) (PutObjectResult, error)
+	// MultipartUpload stores the object assembled from the part files; etag
+	// is the composite ETag returned to the client, to be stored with it.
+	MultipartUpload(publicKey, bucketName, objectName string, meta map[string]string, partsPath []string, size int64, etag string) (PutObjectResult, error)
 	GetObjectV2(publicKey, bucketName, objectName string, rangeRequest *ObjectRangeRequest, prefix *Prefix, page ListBucketPage) (*Object, error)
 	GetObject(publicKey, bucketName, objectName string, rangeRequest *ObjectRangeRequest) (*Object, error)
 	DeleteBucket(publicKey, name string) error
@@ -54,7 +76,71 @@ type Backend interface {
 	DeleteObject(publicKey, bucketName, objectName string) (ObjectDeleteResult, error)
 }
 
-type VersionedBackend interface{}
+// VersionedBackend may be implemented by a Backend to support the S3 object
+// versioning API. If it is not implemented, or WithoutVersioning is passed,
+// requests for specific versions fail with ErrNotImplemented.
+type VersionedBackend interface {
+	VersioningConfiguration(publicKey, bucketName string) (VersioningConfiguration, error)
+	SetVersioningConfiguration(publicKey, bucketName string, v VersioningConfiguration) error
+	GetObjectVersion(publicKey, bucketName, objectName string, versionID VersionID, rangeRequest *ObjectRangeRequest) (*Object, error)
+	HeadObjectVersion(publicKey, bucketName, objectName string, versionID VersionID) (*Object, error)
+	DeleteObjectVersion(publicKey, bucketName, objectName string, versionID VersionID) (ObjectDeleteResult, error)
+	ListBucketVersions(publicKey, bucketName string, prefix *Prefix, page *ListBucketVersionsPage) (*ListBucketVersionsResult, error)
+}
+
+// CopyingBackend may be implemented by a Backend to copy objects without
+// reading their content back and uploading it again. meta holds the stored
+// headers of the destination, already resolved from the metadata directive.
+// CopyObject fails with ErrNotImplemented if the object has to be streamed
+// from the source to the destination instead.
+type CopyingBackend interface {
+	CopyObject(publicKey, srcBucket, srcKey string, srcVersionID VersionID, dstBucket, dstKey string, meta map[string]string) (ObjectCopyResult, error)
+}
+
+// TaggingBackend may be implemented by a Backend to support the object
+// tagging API. The tag set is stored with the rest of the object meta data,
+// so a Backend that does not implement it still keeps the tags given with
+// x-amz-tagging when an object is uploaded.
+type TaggingBackend interface {
+	ObjectTagging(publicKey, bucketName, objectName string, versionID VersionID) (Tagging, error)
+	SetObjectTagging(publicKey, bucketName, objectName string, versionID VersionID, tagging Tagging) error
+}
+
+// BucketConfigBackend may be implemented by a Backend to keep the
+// configuration documents of the bucket sub-resources, such as ?tagging or
+// ?policy, with the bucket. BucketConfig returns nil if the bucket has no
+// document of that name; SetBucketConfig deletes it if doc is nil.
+type BucketConfigBackend interface {
+	BucketConfig(publicKey, bucketName, name string) ([]byte, error)
+	SetBucketConfig(publicKey, bucketName, name string, doc []byte) error
+}
+
+// The names of the documents kept by a BucketConfigBackend; they are named
+// after their sub-resource.
+const (
+	BucketConfigTagging   = "tagging"
+	BucketConfigPolicy    = "policy"
+	BucketConfigACL       = "acl"
+	BucketConfigLifecycle = "lifecycle"
+)
+
+// ACLBackend may be implemented by a Backend to keep the ACLs of objects.
+// ObjectACL returns nil for an object that has not been given one. The READ
+// grants to other users are the only ones that give access, as YottaChain
+// licences.
+type ACLBackend interface {
+	ObjectACL(publicKey, bucketName, objectName string, versionID VersionID) (*AccessControlPolicy, error)
+	SetObjectACL(publicKey, bucketName, objectName string, versionID VersionID, acl *AccessControlPolicy) error
+}
+
+type ObjectCopyResult struct {
+	// The version ID of the new object, if the destination bucket is
+	// versioned.
+	VersionID VersionID
+
+	// The time the new object was created.
+	LastModified time.Time
+}
 
 type ObjectDeleteResult struct {
 	// Specifies whether the versioned object that was permanently deleted was
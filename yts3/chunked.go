@@ -0,0 +1,193 @@
+package yts3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	streamingPayload      = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingChunkAlgo    = "AWS4-HMAC-SHA256-PAYLOAD"
+	chunkSignatureField   = "chunk-signature="
+	maxChunkHeaderLength  = 4096
+	maxStreamingChunkSize = 16 << 20
+)
+
+var emptySHA256 = sha256.Sum256(nil)
+
+// isStreamingPayload reports whether the body of rq is aws-chunked encoded,
+// as sent by the AWS SDKs for large PutObject and UploadPart requests.
+func isStreamingPayload(rq *http.Request) bool {
+	return rq.Header.Get("X-Amz-Content-Sha256") == streamingPayload
+}
+
+// stripAWSChunked removes the aws-chunked token from a Content-Encoding
+// value. It only describes how a streaming upload was sent, not how the
+// object is encoded, so it is not stored with the object.
+func stripAWSChunked(encoding string) string {
+	var kept []string
+	for _, token := range strings.Split(encoding, ",") {
+		if token = strings.TrimSpace(token); token != "" && !strings.EqualFold(token, "aws-chunked") {
+			kept = append(kept, token)
+		}
+	}
+	return strings.Join(kept, ",")
+}
+
+// requestContentLength returns the length of the object data carried by rq.
+// For aws-chunked bodies that is x-amz-decoded-content-length; Content-Length
+// also counts the chunk headers and signatures.
+func requestContentLength(rq *http.Request) (int64, error) {
+	if isStreamingPayload(rq) {
+		return strconv.ParseInt(rq.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+	}
+	return strconv.ParseInt(rq.Header.Get("Content-Length"), 10, 64)
+}
+
+// chunkSigner holds what is needed to verify the chunk signatures of a
+// signed aws-chunked body. Each chunk is signed over the previous chunk's
+// signature, starting with the signature of the request itself.
+type chunkSigner struct {
+	key      []byte
+	amzDate  string
+	scope    string
+	previous string
+}
+
+func (s *chunkSigner) sign(chunk []byte) string {
+	hashed := sha256.Sum256(chunk)
+	stringToSign := streamingChunkAlgo + "\n" +
+		s.amzDate + "\n" +
+		s.scope + "\n" +
+		s.previous + "\n" +
+		hex.EncodeToString(emptySHA256[:]) + "\n" +
+		hex.EncodeToString(hashed[:])
+	return hex.EncodeToString(hmacSHA256(s.key, []byte(stringToSign)))
+}
+
+// chunkedReader decodes an aws-chunked body:
+//
+//	hex(size);chunk-signature=sig\r\n
+//	data\r\n
+//	...
+//	0;chunk-signature=sig\r\n
+//	\r\n
+//
+// A chunk is only handed out once its signature has been checked. When
+// signer is nil (signature verification disabled) the signatures are
+// skipped.
+type chunkedReader struct {
+	inner   io.ReadCloser
+	rd      *bufio.Reader
+	signer  *chunkSigner
+	chunk   []byte
+	pos     int
+	read    int64
+	decoded int64
+	err     error
+}
+
+func newChunkedReader(body io.ReadCloser, signer *chunkSigner, decodedLength int64) *chunkedReader {
+	return &chunkedReader{
+		inner:   body,
+		rd:      bufio.NewReader(body),
+		signer:  signer,
+		decoded: decodedLength,
+	}
+}
+
+func (c *chunkedReader) Read(p []byte) (n int, err error) {
+	for c.pos == len(c.chunk) {
+		if c.err != nil {
+			return 0, c.err
+		}
+		c.err = c.nextChunk()
+		if c.err == io.EOF && c.decoded >= 0 && c.read != c.decoded {
+			c.err = ErrIncompleteBody
+		}
+	}
+	n = copy(p, c.chunk[c.pos:])
+	c.pos += n
+	return n, nil
+}
+
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	sizeHex, signature := line, ""
+	if idx := strings.IndexByte(line, ';'); idx >= 0 {
+		sizeHex = line[:idx]
+		ext := line[idx+1:]
+		if !strings.HasPrefix(ext, chunkSignatureField) {
+			return ErrorMessage(ErrInvalidRequest, "malformed aws-chunked chunk header")
+		}
+		signature = ext[len(chunkSignatureField):]
+	}
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 || size > maxStreamingChunkSize {
+		return ErrorMessage(ErrInvalidRequest, "malformed aws-chunked chunk size")
+	}
+	if c.decoded >= 0 && c.read+size > c.decoded {
+		// Rejected before any of the chunk is handed out.
+		return ErrorMessage(ErrInvalidRequest, "the aws-chunked body is longer than X-Amz-Decoded-Content-Length")
+	}
+	if cap(c.chunk) < int(size) {
+		c.chunk = make([]byte, size)
+	}
+	c.chunk = c.chunk[:size]
+	c.pos = 0
+	if _, err := io.ReadFull(c.rd, c.chunk); err != nil {
+		c.chunk = c.chunk[:0]
+		return ErrIncompleteBody
+	}
+	if crlf, err := c.readLine(); err != nil || crlf != "" {
+		c.chunk = c.chunk[:0]
+		return ErrIncompleteBody
+	}
+	if c.signer != nil {
+		expected := c.signer.sign(c.chunk)
+		if !hmac.Equal([]byte(expected), []byte(signature)) {
+			c.chunk = c.chunk[:0]
+			return ErrSignatureDoesNotMatch
+		}
+		c.signer.previous = expected
+	}
+	c.read += size
+	if size == 0 {
+		return io.EOF
+	}
+	return nil
+}
+
+func (c *chunkedReader) readLine() (string, error) {
+	var line []byte
+	for {
+		part, isPrefix, err := c.rd.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				return "", ErrIncompleteBody
+			}
+			return "", err
+		}
+		line = append(line, part...)
+		if len(line) > maxChunkHeaderLength {
+			return "", ErrorMessage(ErrInvalidRequest, "aws-chunked chunk header too long")
+		}
+		if !isPrefix {
+			return string(bytes.TrimSpace(line)), nil
+		}
+	}
+}
+
+func (c *chunkedReader) Close() error {
+	return c.inner.Close()
+}
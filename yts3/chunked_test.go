@@ -0,0 +1,121 @@
+package yts3
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// The signatures of the aws-chunked example of the AWS Signature Version 4
+// documentation: 66560 bytes of 'a' sent as chunks of 65536 and 1024 bytes.
+const (
+	exampleSeedSignature   = "4f232c4386841ef735655705268965c44a0e4690baa4adea153f7db9fa80a0a9"
+	exampleChunk1Signature = "ad80c730a21e5b8d04586a2213dd63b9a0e99e0e2307b0ade35a65485a288648"
+	exampleChunk2Signature = "0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497"
+	exampleFinalSignature  = "b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9"
+)
+
+func exampleChunkSigner() *chunkSigner {
+	scope := credentialScope{accessKey: exampleAccessKey, date: "20130524", region: "us-east-1", service: "s3"}
+	return &chunkSigner{
+		key:      signingKeyV4(exampleSecretKey, scope),
+		amzDate:  "20130524T000000Z",
+		scope:    scope.String(),
+		previous: exampleSeedSignature,
+	}
+}
+
+func chunkedBody(chunks ...string) string {
+	return strings.Join(chunks, "")
+}
+
+func chunk(data, signature string) string {
+	return fmt.Sprintf("%x;chunk-signature=%s\r\n%s\r\n", len(data), signature, data)
+}
+
+var (
+	exampleChunk1 = strings.Repeat("a", 65536)
+	exampleChunk2 = strings.Repeat("a", 1024)
+	exampleBody   = chunkedBody(
+		chunk(exampleChunk1, exampleChunk1Signature),
+		chunk(exampleChunk2, exampleChunk2Signature),
+		chunk("", exampleFinalSignature),
+	)
+)
+
+func TestChunkedReader(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		body    string
+		signed  bool
+		decoded int64
+		expect  ErrorCode
+	}{
+		{"example", exampleBody, true, 66560, ErrNone},
+		{"unknown length", exampleBody, true, -1, ErrNone},
+		{"unsigned", exampleBody, false, 66560, ErrNone},
+		{"decoded length too short", exampleBody, true, 66559, ErrInvalidRequest},
+		{"decoded length too long", exampleBody, true, 66561, ErrIncompleteBody},
+		{"bad chunk signature", strings.Replace(exampleBody, exampleChunk2Signature, exampleChunk1Signature, 1), true, 66560, ErrSignatureDoesNotMatch},
+		{"chunks reordered", chunkedBody(
+			chunk(exampleChunk2, exampleChunk2Signature),
+			chunk(exampleChunk1, exampleChunk1Signature),
+			chunk("", exampleFinalSignature),
+		), true, 66560, ErrSignatureDoesNotMatch},
+		{"no final chunk", chunkedBody(
+			chunk(exampleChunk1, exampleChunk1Signature),
+			chunk(exampleChunk2, exampleChunk2Signature),
+		), true, 66560, ErrIncompleteBody},
+		{"truncated chunk", exampleBody[:1000], true, 66560, ErrIncompleteBody},
+		{"missing crlf", strings.Replace(exampleBody, exampleChunk2+"\r\n", exampleChunk2+"xx", 1), false, 66560, ErrIncompleteBody},
+		{"malformed extension", "400;signature=" + exampleChunk1Signature + "\r\n", false, 66560, ErrInvalidRequest},
+		{"malformed size", "zz;chunk-signature=" + exampleChunk1Signature + "\r\n", false, 66560, ErrInvalidRequest},
+		{"chunk too large", fmt.Sprintf("%x;chunk-signature=%s\r\n", maxStreamingChunkSize+1, exampleChunk1Signature), false, -1, ErrInvalidRequest},
+		{"header too long", strings.Repeat("0", maxChunkHeaderLength+1) + "\r\n", false, -1, ErrInvalidRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var signer *chunkSigner
+			if tc.signed {
+				signer = exampleChunkSigner()
+			}
+			rd := newChunkedReader(ioutil.NopCloser(strings.NewReader(tc.body)), signer, tc.decoded)
+			data, err := ioutil.ReadAll(rd)
+			if !HasErrorCode(err, tc.expect) {
+				t.Fatalf("expected %q, got %v", tc.expect, err)
+			}
+			if err == nil && string(data) != exampleChunk1+exampleChunk2 {
+				t.Fatalf("expected %d bytes of data, got %d", 66560, len(data))
+			}
+		})
+	}
+}
+
+func TestChunkedReaderOverLength(t *testing.T) {
+	// A chunk that goes past the decoded length is refused before any of it
+	// is read, so that it is never handed out.
+	rd := newChunkedReader(ioutil.NopCloser(strings.NewReader(exampleBody)), exampleChunkSigner(), 1024)
+	data, err := ioutil.ReadAll(rd)
+	if !HasErrorCode(err, ErrInvalidRequest) {
+		t.Fatalf("expected %q, got %v", ErrInvalidRequest, err)
+	}
+	if len(data) != 0 {
+		t.Fatalf("expected no data, got %d bytes", len(data))
+	}
+}
+
+func TestStripAWSChunked(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{"aws-chunked", ""},
+		{"aws-chunked,gzip", "gzip"},
+		{"gzip, aws-chunked", "gzip"},
+		{"gzip,AWS-Chunked,br", "gzip,br"},
+		{"", ""},
+	} {
+		if out := stripAWSChunked(tc.in); out != tc.out {
+			t.Errorf("stripAWSChunked(%q): expected %q, got %q", tc.in, tc.out, out)
+		}
+	}
+}
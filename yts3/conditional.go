@@ -0,0 +1,229 @@
+package yts3
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// etagMatches reports whether the ETag list of an If-Match or If-None-Match
+// header contains etag. Weak and strong ETags compare the same, as S3 only
+// hands out strong ones.
+func etagMatches(header, etag string) bool {
+	etag = strings.Trim(etag, `"`)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if strings.Trim(candidate, `"`) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConditions evaluates the conditional request headers against the ETag
+// and modification time of an object, in the order of RFC 7232 section 6. It
+// returns ErrPreconditionFailed or ErrNotModified if the request should not
+// be served. The date conditions are skipped if lastModified is unknown.
+func checkConditions(h http.Header, etag string, lastModified time.Time) error {
+	lastModified = lastModified.Truncate(time.Second)
+	if im := h.Get("If-Match"); im != "" {
+		if !etagMatches(im, etag) {
+			return ErrPreconditionFailed
+		}
+	} else if ius := h.Get("If-Unmodified-Since"); ius != "" && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ius); err == nil && lastModified.After(t) {
+			return ErrPreconditionFailed
+		}
+	}
+	if inm := h.Get("If-None-Match"); inm != "" {
+		if etagMatches(inm, etag) {
+			return ErrNotModified
+		}
+	} else if ims := h.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !lastModified.After(t) {
+			return ErrNotModified
+		}
+	}
+	return nil
+}
+
+// copySourceConditions maps the x-amz-copy-source-if-* headers of a copy
+// request to the conditional headers they stand for.
+var copySourceConditions = map[string]string{
+	"X-Amz-Copy-Source-If-Match":            "If-Match",
+	"X-Amz-Copy-Source-If-None-Match":       "If-None-Match",
+	"X-Amz-Copy-Source-If-Modified-Since":   "If-Modified-Since",
+	"X-Amz-Copy-Source-If-Unmodified-Since": "If-Unmodified-Since",
+}
+
+// checkCopySourceConditions evaluates the x-amz-copy-source-if-* headers of
+// a copy request against the source object. Unlike the conditions of a GET,
+// every failed condition is reported as ErrPreconditionFailed.
+func checkCopySourceConditions(h http.Header, src *Object) error {
+	cond := make(http.Header)
+	for k, v := range copySourceConditions {
+		if hv := h.Get(k); hv != "" {
+			cond.Set(v, hv)
+		}
+	}
+	if len(cond) == 0 {
+		return nil
+	}
+	lastModified, _ := http.ParseTime(src.Metadata["Last-Modified"])
+	if err := checkConditions(cond, src.Metadata["ETag"], lastModified); err != nil {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// writeConditionalResponse checks the conditional headers of a GET or HEAD
+// request against obj. It reports whether the request has been answered
+// with 304 Not Modified; a failed precondition is returned as an error.
+func (g *Yts3) writeConditionalResponse(obj *Object, w http.ResponseWriter, r *http.Request) (bool, error) {
+	if obj.IsDeleteMarker {
+		return false, nil
+	}
+	etag := obj.Metadata["ETag"]
+	lastModified, _ := http.ParseTime(obj.Metadata["Last-Modified"])
+	switch err := checkConditions(r.Header, etag, lastModified); err {
+	case nil:
+		return false, nil
+	case ErrNotModified:
+		w.Header().Set("ETag", `"`+strings.Trim(etag, `"`)+`"`)
+		if !lastModified.IsZero() {
+			w.Header().Set("Last-Modified", formatHeaderTime(lastModified))
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return true, nil
+	default:
+		return false, err
+	}
+}
+
+// keyLocks serializes the writes to the same object in this gateway, so that
+// the check of a conditional write against the current object and the write
+// that depends on it are not interleaved with another write. Every write of
+// an object or of its meta data, such as its tags and ACL, takes the lock.
+// Writes through other gateway hosts are not serialized, so across hosts the
+// conditions are only checked on a best-effort basis.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks key and returns the function that unlocks it.
+func (k *keyLocks) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyLock)
+	}
+	l := k.locks[key]
+	if l == nil {
+		l = &keyLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// lockObject locks object for a write and returns the function that unlocks
+// it.
+func (g *Yts3) lockObject(publicKey, bucket, object string) func() {
+	return g.writeLocks.lock(ownerBucket(publicKey, bucket) + "/" + object)
+}
+
+// lockObjects locks every object of a write to several objects and returns
+// the function that unlocks them. They are locked in order, so that two
+// such writes cannot wait for each other.
+func (g *Yts3) lockObjects(publicKey, bucket string, objects []string) func() {
+	sorted := append([]string(nil), objects...)
+	sort.Strings(sorted)
+	var unlocks []func()
+	for i, object := range sorted {
+		if i > 0 && object == sorted[i-1] {
+			continue
+		}
+		unlocks = append(unlocks, g.lockObject(publicKey, bucket, object))
+	}
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+// lockWrite locks object for a write and returns the function that unlocks
+// it. If-Match and If-None-Match are checked while the lock is held; when
+// they fail the object is left unlocked.
+func (g *Yts3) lockWrite(publicKey, bucket, object string, r *http.Request) (func(), error) {
+	unlock := g.lockObject(publicKey, bucket, object)
+	if hasWriteConditions(r) {
+		if err := g.checkWriteConditions(publicKey, bucket, object, r); err != nil {
+			unlock()
+			return nil, err
+		}
+	}
+	return unlock, nil
+}
+
+// hasWriteConditions reports whether a PUT or CompleteMultipartUpload carries
+// If-Match or If-None-Match.
+func hasWriteConditions(r *http.Request) bool {
+	return r.Header.Get("If-Match") != "" || r.Header.Get("If-None-Match") != ""
+}
+
+// checkWriteConditions evaluates If-Match and If-None-Match of a write
+// against the current version of the object: "If-None-Match: *" only
+// creates objects that do not exist yet, and If-Match only replaces the
+// object with the given ETag. The caller must hold the key lock.
+func (g *Yts3) checkWriteConditions(publicKey, bucket, object string, r *http.Request) error {
+	im, inm := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	if inm != "" && inm != "*" {
+		return ErrorMessage(ErrNotImplemented, "If-None-Match only supports *")
+	}
+	obj, err := g.storage.HeadObject(publicKey, bucket, object)
+	exists := err == nil && obj != nil && !obj.IsDeleteMarker
+	if err != nil && !HasErrorCode(err, ErrNoSuchKey) {
+		return err
+	}
+	if obj != nil && obj.Contents != nil {
+		obj.Contents.Close()
+	}
+	if inm == "*" && exists {
+		logrus.Infof("[S3Upload]/%s/%s already exists\n", bucket, object)
+		return ErrPreconditionFailed
+	}
+	if im != "" {
+		if !exists {
+			return KeyNotFound(object)
+		}
+		if !etagMatches(im, obj.Metadata["ETag"]) {
+			logrus.Infof("[S3Upload]/%s/%s ETag does not match %s\n", bucket, object, im)
+			return ErrPreconditionFailed
+		}
+	}
+	return nil
+}
@@ -36,9 +36,17 @@ const (
 	MaxBucketKeys        = 1000
 	DefaultMaxBucketKeys = 1000
 
+	// DefaultMaxRanges is the number of byte ranges served in one GET,
+	// see WithMaxRanges.
+	DefaultMaxRanges = 16
+
 	MaxBucketVersionKeys        = 1000
 	DefaultMaxBucketVersionKeys = 1000
 
 	// From the docs: "Part numbers can be any number from 1 to 10,000, inclusive."
 	MaxUploadPartNumber = 10000
+
+	// From the UploadPartCopy docs: the largest part that can be copied from
+	// an existing object is 5 GB.
+	MaxUploadPartSize = 5 * 1024 * 1024 * 1024
 )
@@ -10,6 +10,12 @@ import (
 const (
 	ErrNone ErrorCode = ""
 
+	ErrAccessDenied ErrorCode = "AccessDenied"
+
+	ErrAuthorizationHeaderMalformed ErrorCode = "AuthorizationHeaderMalformed"
+
+	ErrAuthorizationQueryParametersError ErrorCode = "AuthorizationQueryParametersError"
+
 	ErrBadDigest ErrorCode = "BadDigest"
 
 	ErrInvalidAccessKeyID ErrorCode = "InvalidAccessKeyID"
@@ -33,6 +39,7 @@ const (
 	ErrInvalidDigest ErrorCode = "InvalidDigest"
 
 	ErrInvalidRange         ErrorCode = "InvalidRange"
+	ErrInvalidTag           ErrorCode = "InvalidTag"
 	ErrInvalidToken         ErrorCode = "InvalidToken"
 	ErrKeyTooLong           ErrorCode = "KeyTooLongError"
 	ErrMalformedPOSTRequest ErrorCode = "MalformedPOSTRequest"
@@ -41,8 +48,12 @@ const (
 
 	ErrInvalidPartOrder ErrorCode = "InvalidPartOrder"
 
+	ErrInvalidRequest ErrorCode = "InvalidRequest"
+
 	ErrInvalidURI ErrorCode = "InvalidURI"
 
+	ErrMalformedACL     ErrorCode = "MalformedACLError"
+	ErrMalformedPolicy  ErrorCode = "MalformedPolicy"
 	ErrMetadataTooLarge ErrorCode = "MetadataTooLarge"
 	ErrMethodNotAllowed ErrorCode = "MethodNotAllowed"
 	ErrMalformedXML     ErrorCode = "MalformedXML"
@@ -51,16 +62,35 @@ const (
 
 	ErrNoSuchBucket ErrorCode = "NoSuchBucket"
 
+	ErrNoSuchBucketPolicy ErrorCode = "NoSuchBucketPolicy"
+
 	ErrNoSuchKey ErrorCode = "NoSuchKey"
 
+	ErrNoSuchLifecycleConfiguration ErrorCode = "NoSuchLifecycleConfiguration"
+
+	ErrNoSuchTagSet ErrorCode = "NoSuchTagSet"
+
 	ErrNoSuchUpload ErrorCode = "NoSuchUpload"
 
 	ErrNoSuchVersion ErrorCode = "NoSuchVersion"
 
+	ErrNotModified ErrorCode = "NotModified"
+
+	// ErrOperationAborted is returned for requests that conflict with an
+	// operation in progress on the same resource, such as aborting a
+	// multipart upload while it is being completed.
+	ErrOperationAborted ErrorCode = "OperationAborted"
+
+	ErrPreconditionFailed ErrorCode = "PreconditionFailed"
+
 	ErrRequestTimeTooSkewed ErrorCode = "RequestTimeTooSkewed"
 	ErrTooManyBuckets       ErrorCode = "TooManyBuckets"
 	ErrNotImplemented       ErrorCode = "NotImplemented"
 
+	ErrSignatureDoesNotMatch ErrorCode = "SignatureDoesNotMatch"
+
+	ErrXAmzContentSHA256Mismatch ErrorCode = "XAmzContentSHA256Mismatch"
+
 	ErrInternal      ErrorCode = "InternalError"
 	ErrAuthorization ErrorCode = "NotAuthorization"
 )
@@ -159,8 +189,22 @@ func (e ErrorCode) Message() string {
 		return "The specified bucket does not exist"
 	case ErrRequestTimeTooSkewed:
 		return "The difference between the request time and the current time is too large"
-	case ErrMalformedXML:
+	case ErrSignatureDoesNotMatch:
+		return "The request signature we calculated does not match the signature you provided"
+	case ErrAccessDenied:
+		return "Access Denied"
+	case ErrMalformedXML, ErrMalformedACL:
 		return "The XML you provided was not well-formed or did not validate against our published schema"
+	case ErrNoSuchLifecycleConfiguration:
+		return "The lifecycle configuration does not exist"
+	case ErrNoSuchTagSet:
+		return "The TagSet does not exist"
+	case ErrNoSuchBucketPolicy:
+		return "The bucket policy does not exist"
+	case ErrPreconditionFailed:
+		return "At least one of the pre-conditions you specified did not hold"
+	case ErrOperationAborted:
+		return "A conflicting conditional operation is currently in progress against this resource. Try again."
 	default:
 		return ""
 	}
@@ -169,7 +213,8 @@ func (e ErrorCode) Message() string {
 func (e ErrorCode) Status() int {
 	switch e {
 	case ErrBucketAlreadyExists,
-		ErrBucketNotEmpty:
+		ErrBucketNotEmpty,
+		ErrOperationAborted:
 		return http.StatusConflict
 
 	case ErrBadDigest,
@@ -182,6 +227,8 @@ func (e ErrorCode) Status() int {
 		ErrInvalidDigest,
 		ErrInvalidPart,
 		ErrInvalidPartOrder,
+		ErrInvalidRequest,
+		ErrInvalidTag,
 		ErrInvalidToken,
 		ErrInvalidURI,
 		ErrKeyTooLong,
@@ -189,17 +236,28 @@ func (e ErrorCode) Status() int {
 		ErrMethodNotAllowed,
 		ErrMalformedPOSTRequest,
 		ErrMalformedXML,
+		ErrMalformedACL,
+		ErrMalformedPolicy,
+		ErrAuthorizationHeaderMalformed,
+		ErrAuthorizationQueryParametersError,
+		ErrXAmzContentSHA256Mismatch,
 		ErrTooManyBuckets:
 		return http.StatusBadRequest
 
-	case ErrRequestTimeTooSkewed:
+	case ErrRequestTimeTooSkewed,
+		ErrAccessDenied,
+		ErrInvalidAccessKeyID,
+		ErrSignatureDoesNotMatch:
 		return http.StatusForbidden
 
 	case ErrInvalidRange:
 		return http.StatusRequestedRangeNotSatisfiable
 
 	case ErrNoSuchBucket,
+		ErrNoSuchBucketPolicy,
 		ErrNoSuchKey,
+		ErrNoSuchLifecycleConfiguration,
+		ErrNoSuchTagSet,
 		ErrNoSuchUpload,
 		ErrNoSuchVersion:
 		return http.StatusNotFound
@@ -207,6 +265,12 @@ func (e ErrorCode) Status() int {
 	case ErrNotImplemented:
 		return http.StatusNotImplemented
 
+	case ErrNotModified:
+		return http.StatusNotModified
+
+	case ErrPreconditionFailed:
+		return http.StatusPreconditionFailed
+
 	case ErrMissingContentLength:
 		return http.StatusLengthRequired
 
@@ -0,0 +1,285 @@
+package yts3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ACLMetaKey is the meta entry that holds the ACL of an object, as an
+// AccessControlPolicy document.
+const ACLMetaKey = "acl"
+
+// grantHeaders maps the x-amz-grant-* headers to the permission they grant.
+var grantHeaders = map[string]Permission{
+	"x-amz-grant-read":         PermissionRead,
+	"x-amz-grant-write":        PermissionWrite,
+	"x-amz-grant-read-acp":     PermissionReadACP,
+	"x-amz-grant-write-acp":    PermissionWriteACP,
+	"x-amz-grant-full-control": PermissionFullControl,
+}
+
+func (g *Yts3) routeObjectACL(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getObjectACL(bucket, object, versionID, w, r)
+	case "PUT":
+		return g.putObjectACL(bucket, object, versionID, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+func (g *Yts3) routeBucketACL(bucket string, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getBucketACL(bucket, w, r)
+	case "PUT":
+		return g.putBucketACL(bucket, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+func (g *Yts3) getObjectACL(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[ACL]GET OBJECT ACL:%s/%s,%s\n", bucket, object, versionID)
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[ACL]getObjectACL ErrAuthorization\n")
+		return err
+	}
+	var acl *AccessControlPolicy
+	if g.acls != nil {
+		acl, err = g.acls.ObjectACL(publicKey, bucket, object, versionID)
+		if err != nil {
+			return err
+		}
+	}
+	if acl == nil {
+		acl = defaultACL(publicKey)
+	}
+	acl.Owner = ownerInfo(publicKey)
+	if versionID != "" {
+		w.Header().Set("x-amz-version-id", string(versionID))
+	}
+	return g.xmlEncoder(w).Encode(acl)
+}
+
+// putObjectACL replaces the ACL of an object. READ grants to other users are
+// turned into YottaChain licences by the Backend, so that they can download
+// the object. The Backend resolves the grantees among the users logged in to
+// this gateway, so only they can be granted READ; grants to any other ID fail
+// with InvalidArgument.
+func (g *Yts3) putObjectACL(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[ACL]PUT OBJECT ACL:%s/%s,%s\n", bucket, object, versionID)
+	if g.acls == nil {
+		return ErrNotImplemented
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[ACL]putObjectACL ErrAuthorization\n")
+		return err
+	}
+	acl, err := g.requestACL(publicKey, r)
+	if err != nil {
+		return err
+	}
+	for _, grant := range acl.AccessControlList.Grants {
+		if grant.Grantee.ID != "YTA"+publicKey && grant.Permission != PermissionRead {
+			return ErrorMessagef(ErrNotImplemented, "only READ can be granted to other users, not %s", grant.Permission)
+		}
+	}
+	unlock := g.lockObject(publicKey, bucket, object)
+	defer unlock()
+	if err := g.acls.SetObjectACL(publicKey, bucket, object, versionID, acl); err != nil {
+		logrus.Errorf("[ACL]/%s/%s,SetObjectACL err:%s\n", bucket, object, err)
+		return err
+	}
+	if versionID != "" {
+		w.Header().Set("x-amz-version-id", string(versionID))
+	}
+	return nil
+}
+
+func (g *Yts3) getBucketACL(bucket string, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[ACL]GET BUCKET ACL:%s\n", bucket)
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[ACL]getBucketACL ErrAuthorization\n")
+		return err
+	}
+	acl := defaultACL(publicKey)
+	if g.configs != nil {
+		doc, err := g.configs.BucketConfig(publicKey, bucket, BucketConfigACL)
+		if err != nil {
+			return err
+		}
+		if doc != nil {
+			acl = &AccessControlPolicy{}
+			if err := xml.Unmarshal(doc, acl); err != nil {
+				logrus.Errorf("[ACL]%s stored acl err:%s\n", bucket, err)
+				return err
+			}
+		}
+	}
+	acl.Owner = ownerInfo(publicKey)
+	return g.xmlEncoder(w).Encode(acl)
+}
+
+// putBucketACL stores the ACL of a bucket. YottaChain licenses objects one
+// by one, so a bucket can only be granted to its owner; other users are
+// granted READ on the objects instead.
+func (g *Yts3) putBucketACL(bucket string, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[ACL]PUT BUCKET ACL:%s\n", bucket)
+	if g.configs == nil {
+		return ErrNotImplemented
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[ACL]putBucketACL ErrAuthorization\n")
+		return err
+	}
+	acl, err := g.requestACL(publicKey, r)
+	if err != nil {
+		return err
+	}
+	for _, grant := range acl.AccessControlList.Grants {
+		if grant.Grantee.ID != "YTA"+publicKey {
+			return ErrorMessage(ErrNotImplemented, "buckets cannot be granted to other users, grant READ on their objects instead")
+		}
+	}
+	doc, err := xml.Marshal(acl)
+	if err != nil {
+		return err
+	}
+	return g.configs.SetBucketConfig(publicKey, bucket, BucketConfigACL, doc)
+}
+
+// requestACL returns the ACL a PUT ?acl request sets: a canned ACL from
+// x-amz-acl, the grants of the x-amz-grant-* headers, or the
+// AccessControlPolicy in the body.
+func (g *Yts3) requestACL(publicKey string, r *http.Request) (*AccessControlPolicy, error) {
+	owner := ownerInfo(publicKey)
+	var acl *AccessControlPolicy
+	canned := r.Header.Get("x-amz-acl")
+	grants, err := headerGrants(r.Header)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case canned != "" && len(grants) > 0:
+		return nil, ErrorMessage(ErrInvalidRequest, "Specifying both Canned ACLs and Header Grants is not allowed")
+	case canned != "":
+		if acl, err = cannedACL(publicKey, canned); err != nil {
+			return nil, err
+		}
+	case len(grants) > 0:
+		acl = defaultACL(publicKey)
+		acl.AccessControlList.Grants = append(acl.AccessControlList.Grants, grants...)
+	default:
+		acl = &AccessControlPolicy{}
+		if err := g.xmlDecodeBody(r.Body, acl); err != nil {
+			return nil, err
+		}
+		if acl.Owner != nil && acl.Owner.ID != owner.ID {
+			return nil, ErrAccessDenied
+		}
+	}
+	acl.Owner = owner
+	for _, grant := range acl.AccessControlList.Grants {
+		switch grant.Permission {
+		case PermissionFullControl, PermissionRead, PermissionWrite, PermissionReadACP, PermissionWriteACP:
+		default:
+			return nil, ErrMalformedACL
+		}
+		switch grant.Grantee.Type {
+		case GranteeCanonicalUser:
+		case GranteeGroup, GranteeEmail:
+			return nil, ErrorMessagef(ErrNotImplemented, "%s grantees cannot be mapped onto YottaChain licensing", grant.Grantee.Type)
+		default:
+			return nil, ErrMalformedACL
+		}
+		if !strings.HasPrefix(grant.Grantee.ID, "YTA") {
+			return nil, ErrorMessage(ErrInvalidArgument, "Invalid id")
+		}
+	}
+	return acl, nil
+}
+
+// headerGrants parses the x-amz-grant-* headers, each a comma separated
+// list of grantees such as id="YTA...".
+func headerGrants(h http.Header) ([]Grant, error) {
+	var grants []Grant
+	for header, permission := range grantHeaders {
+		v := h.Get(header)
+		if v == "" {
+			continue
+		}
+		for _, grantee := range strings.Split(v, ",") {
+			kv := strings.SplitN(strings.TrimSpace(grantee), "=", 2)
+			if len(kv) != 2 {
+				return nil, ErrorMessagef(ErrInvalidArgument, "Invalid grantee in %s", header)
+			}
+			value := strings.Trim(kv[1], `"`)
+			switch strings.ToLower(kv[0]) {
+			case "id":
+				grants = append(grants, Grant{Grantee: Grantee{Type: GranteeCanonicalUser, ID: value}, Permission: permission})
+			case "emailaddress":
+				grants = append(grants, Grant{Grantee: Grantee{Type: GranteeEmail, EmailAddress: value}, Permission: permission})
+			case "uri":
+				grants = append(grants, Grant{Grantee: Grantee{Type: GranteeGroup, URI: value}, Permission: permission})
+			default:
+				return nil, ErrorMessagef(ErrInvalidArgument, "Invalid grantee in %s", header)
+			}
+		}
+	}
+	return grants, nil
+}
+
+// cannedACL expands a canned ACL. The bucket owner is always the object
+// owner here, so the bucket-owner-* ACLs are the same as private.
+func cannedACL(publicKey, canned string) (*AccessControlPolicy, error) {
+	switch canned {
+	case "private", "bucket-owner-read", "bucket-owner-full-control":
+		return defaultACL(publicKey), nil
+	case "public-read", "public-read-write", "authenticated-read", "aws-exec-read", "log-delivery-write":
+		return nil, ErrorMessagef(ErrNotImplemented, "the canned ACL %s cannot be mapped onto YottaChain licensing", canned)
+	default:
+		return nil, ErrorInvalidArgument("x-amz-acl", canned, "")
+	}
+}
+
+// defaultACL is the ACL of a bucket or object that has not been given one:
+// the owner has full control.
+func defaultACL(publicKey string) *AccessControlPolicy {
+	owner := ownerInfo(publicKey)
+	return &AccessControlPolicy{
+		Owner: owner,
+		AccessControlList: AccessControlList{Grants: []Grant{{
+			Grantee:    Grantee{Type: GranteeCanonicalUser, ID: owner.ID, DisplayName: owner.DisplayName},
+			Permission: PermissionFullControl,
+		}}},
+	}
+}
+
+// Readers returns the IDs of the users other than the owner that the ACL
+// grants READ.
+func (acl *AccessControlPolicy) Readers() []string {
+	var readers []string
+	for _, grant := range acl.AccessControlList.Grants {
+		if grant.Grantee.Type != GranteeCanonicalUser || grant.Permission != PermissionRead {
+			continue
+		}
+		if acl.Owner != nil && grant.Grantee.ID == acl.Owner.ID {
+			continue
+		}
+		readers = append(readers, grant.Grantee.ID)
+	}
+	return readers
+}
+
+func ownerInfo(publicKey string) *UserInfo {
+	return &UserInfo{ID: "YTA" + publicKey, DisplayName: "YTA" + publicKey}
+}
@@ -2,29 +2,21 @@ package yts3
 
 import (
 	"net/http"
-	"strings"
 
 	"github.com/sirupsen/logrus"
 )
 
 func (g *Yts3) createBucket(bucket string, w http.ResponseWriter, r *http.Request) error {
 	logrus.Infof("[CreateBucket]%s\n", bucket)
-	Authorization := r.Header.Get("Authorization")
-	if Authorization == "" {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
 		logrus.Error("[CreateBucket]ErrAuthorization\n")
-		return ErrAuthorization
-	}
-	publicKey := GetBetweenStr(Authorization, "YTA", "/")
-	content := publicKey[3:]
-	if len(content) > 50 {
-		publicKeyLength := strings.Index(content, ":")
-		contentNew := content[:publicKeyLength]
-		content = contentNew
+		return err
 	}
 	if err := ValidateBucketName(bucket); err != nil {
 		return err
 	}
-	if err := g.storage.CreateBucket(content, bucket); err != nil {
+	if err := g.storage.CreateBucket(publicKey, bucket); err != nil {
 		return err
 	}
 	w.Header().Set("Location", "/"+bucket)
@@ -33,19 +25,12 @@ func (g *Yts3) createBucket(bucket string, w http.ResponseWriter, r *http.Reques
 }
 
 func (g *Yts3) listBuckets(w http.ResponseWriter, r *http.Request) error {
-	Authorization := r.Header.Get("Authorization")
-	if Authorization == "" {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
 		logrus.Error("[listBuckets]ErrAuthorization\n")
-		return ErrAuthorization
-	}
-	publicKey := GetBetweenStr(Authorization, "YTA", "/")
-	content := publicKey[3:]
-	if len(content) > 50 {
-		publicKeyLength := strings.Index(content, ":")
-		contentNew := content[:publicKeyLength]
-		content = contentNew
+		return err
 	}
-	buckets, err := g.storage.ListBuckets(content)
+	buckets, err := g.storage.ListBuckets(publicKey)
 	if err != nil {
 		return err
 	}
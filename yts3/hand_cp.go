@@ -1,8 +1,9 @@
 package yts3
 
 import (
-	"encoding/hex"
+	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -11,53 +12,280 @@ import (
 func (g *Yts3) copyObject(bucket, object string, meta map[string]string, w http.ResponseWriter, r *http.Request) (err error) {
 	source := meta["X-Amz-Copy-Source"]
 	logrus.Infof("[CopyObject]/%s/%s,source:%s\n", bucket, object, source)
-	Authorization := r.Header.Get("Authorization")
-	if Authorization == "" {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
 		logrus.Error("[CopyObject]ErrAuthorization\n")
-		return ErrAuthorization
-	}
-	publicKey := GetBetweenStr(Authorization, "YTA", "/")
-	content := publicKey[3:]
-	if len(content) > 50 {
-		publicKeyLength := strings.Index(content, ":")
-		contentNew := content[:publicKeyLength]
-		content = contentNew
+		return err
 	}
 	if len(object) > KeySizeLimit {
 		return ResourceError(ErrKeyTooLong, object)
 	}
-	// XXX No support for versionId subresource
-	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
-	srcBucket := parts[0]
-	srcKey := strings.SplitN(parts[1], "?", 2)[0]
+	srcBucket, srcKey, srcVersion, err := parseCopySource(source)
+	if err != nil {
+		return err
+	}
+	if err := g.authorize(r, srcBucket, srcKey, getObjectAction(srcVersion)); err != nil {
+		return err
+	}
+	directive := MetadataDirective(strings.ToUpper(r.Header.Get("x-amz-metadata-directive")))
+	switch directive {
+	case "":
+		directive = MetadataDirectiveCopy
+	case MetadataDirectiveCopy, MetadataDirectiveReplace:
+	default:
+		return ErrorMessage(ErrInvalidArgument, "Unknown metadata directive.")
+	}
+	if srcBucket == bucket && srcKey == object && srcVersion == "" && directive == MetadataDirectiveCopy {
+		return ErrorMessage(ErrInvalidRequest, "This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata, storage class, website redirect location or encryption attributes.")
+	}
 
-	srcObj, err := g.storage.GetObject(content, srcBucket, srcKey, nil)
+	srcObj, err := g.headCopySource(publicKey, srcBucket, srcKey, srcVersion)
 	if err != nil {
 		return err
 	}
-	if srcObj == nil {
-		logrus.Errorf("[CopyObject]unexpected nil object for key /%s/%s", bucket, object)
-		return ErrInternal
+	if err := checkCopySourceConditions(r.Header, srcObj); err != nil {
+		logrus.Infof("[CopyObject]/%s/%s,source precondition failed\n", srcBucket, srcKey)
+		return err
 	}
-	defer srcObj.Contents.Close()
-	for k, v := range srcObj.Metadata {
-		if _, found := meta[k]; !found && k != "X-Amz-Acl" {
-			meta[k] = v
-		}
+	tags := srcObj.Metadata[TaggingMetaKey]
+	switch strings.ToUpper(r.Header.Get("x-amz-tagging-directive")) {
+	case "", string(MetadataDirectiveCopy):
+	case string(MetadataDirectiveReplace):
+		tags = meta[TaggingMetaKey]
+	default:
+		return ErrorMessage(ErrInvalidArgument, "Unknown tagging directive.")
+	}
+	if directive == MetadataDirectiveCopy {
+		meta = ObjectMetadata(srcObj.Metadata)
+	} else {
+		meta = ObjectMetadata(meta)
 	}
-	result, err := g.storage.PutObject(content, bucket, object, meta, srcObj.Contents, srcObj.Size)
+	delete(meta, TaggingMetaKey)
+	if tags != "" {
+		meta[TaggingMetaKey] = tags
+	}
+	unlock, err := g.lockWrite(publicKey, bucket, object, r)
 	if err != nil {
 		return err
 	}
+	defer unlock()
+
+	var result ObjectCopyResult
+	copied := false
+	if g.copier != nil {
+		result, err = g.copier.CopyObject(publicKey, srcBucket, srcKey, srcVersion, bucket, object, meta)
+		if err == nil {
+			copied = true
+		} else if !HasErrorCode(err, ErrNotImplemented) {
+			logrus.Errorf("[CopyObject]/%s/%s,err:%s\n", bucket, object, err)
+			return err
+		} else {
+			logrus.Infof("[CopyObject]/%s/%s,streaming from source:%s\n", bucket, object, err)
+		}
+	}
+	if !copied {
+		if result, err = g.streamCopy(publicKey, srcBucket, srcKey, srcVersion, bucket, object, meta); err != nil {
+			return err
+		}
+	}
+	g.applyPolicyGrants(r, publicKey, bucket, object)
+
 	if srcObj.VersionID != "" {
 		w.Header().Set("x-amz-copy-source-version-id", string(srcObj.VersionID))
 	}
 	if result.VersionID != "" {
-		logrus.Errorf("[CopyObject]CREATED VERSION:/%s/%s/%s", bucket, object, result.VersionID)
+		logrus.Infof("[CopyObject]CREATED VERSION:/%s/%s/%s\n", bucket, object, result.VersionID)
 		w.Header().Set("x-amz-version-id", string(result.VersionID))
 	}
+	if result.LastModified.IsZero() {
+		result.LastModified = g.timeSource.Now()
+	}
 	return g.xmlEncoder(w).Encode(CopyObjectResult{
-		ETag:         `"` + hex.EncodeToString(srcObj.Hash) + `"`,
+		ETag:         `"` + strings.Trim(srcObj.Metadata["ETag"], `"`) + `"`,
+		LastModified: NewContentTime(result.LastModified),
+	})
+}
+
+// headCopySource returns the metadata of the source of a copy.
+func (g *Yts3) headCopySource(publicKey, bucket, object string, versionID VersionID) (obj *Object, err error) {
+	if versionID == "" {
+		obj, err = g.storage.HeadObject(publicKey, bucket, object)
+	} else if g.versioned != nil {
+		obj, err = g.versioned.HeadObjectVersion(publicKey, bucket, object, versionID)
+	} else {
+		return nil, ErrNotImplemented
+	}
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		logrus.Errorf("[CopyObject]unexpected nil object for key /%s/%s\n", bucket, object)
+		return nil, ErrInternal
+	}
+	if obj.Contents != nil {
+		obj.Contents.Close()
+	}
+	if obj.IsDeleteMarker {
+		return nil, KeyNotFound(object)
+	}
+	return obj, nil
+}
+
+// streamCopy copies an object by reading it from the source and uploading it
+// to the destination, for backends that cannot copy it themselves.
+func (g *Yts3) streamCopy(publicKey, srcBucket, srcKey string, srcVersion VersionID, bucket, object string, meta map[string]string) (result ObjectCopyResult, err error) {
+	var srcObj *Object
+	if srcVersion == "" {
+		srcObj, err = g.storage.GetObject(publicKey, srcBucket, srcKey, nil)
+	} else {
+		srcObj, err = g.versioned.GetObjectVersion(publicKey, srcBucket, srcKey, srcVersion, nil)
+	}
+	if err != nil {
+		return result, err
+	}
+	if srcObj == nil {
+		logrus.Errorf("[CopyObject]unexpected nil object for key /%s/%s\n", srcBucket, srcKey)
+		return result, ErrInternal
+	}
+	defer srcObj.Contents.Close()
+	put, err := g.storage.PutObject(publicKey, bucket, object, meta, srcObj.Contents, srcObj.Size)
+	if err != nil {
+		return result, err
+	}
+	result.VersionID = put.VersionID
+	// Report the time the backend gave the new object, if it has one yet.
+	if obj, err := g.storage.HeadObject(publicKey, bucket, object); err == nil && obj != nil {
+		if obj.Contents != nil {
+			obj.Contents.Close()
+		}
+		result.LastModified, _ = http.ParseTime(obj.Metadata["Last-Modified"])
+	}
+	return result, nil
+}
+
+// parseCopySource splits the x-amz-copy-source header, "bucket/key" with an
+// optional leading slash and "?versionId=" suffix, into its parts.
+func parseCopySource(source string) (bucket, key string, versionID VersionID, err error) {
+	path, query := source, ""
+	if i := strings.IndexByte(source, '?'); i >= 0 {
+		path, query = source[:i], source[i+1:]
+	}
+	path, err = url.PathUnescape(strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return "", "", "", ErrorMessage(ErrInvalidArgument, "Copy Source must mention the source bucket and key: sourcebucket/sourcekey")
+	}
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", ErrorMessage(ErrInvalidArgument, "Copy Source must mention the source bucket and key: sourcebucket/sourcekey")
+	}
+	if query != "" {
+		q, err := url.ParseQuery(query)
+		if err != nil {
+			return "", "", "", ErrorMessage(ErrInvalidArgument, "Invalid copy source version id")
+		}
+		versionID = VersionID(versionFromQuery(q["versionId"]))
+	}
+	return parts[0], parts[1], versionID, nil
+}
+
+// parseCopySourceRange parses x-amz-copy-source-range, which unlike the Range
+// header must name both the first and the last byte to copy.
+func parseCopySourceRange(s string) (*ObjectRangeRequest, error) {
+	if s == "" {
+		return nil, nil
+	}
+	rnge, err := parseRangeHeader(s)
+	if err != nil || rnge.FromEnd || rnge.End == RangeNoEnd {
+		return nil, ErrorMessage(ErrInvalidArgument, "The x-amz-copy-source-range value must be of the form bytes=first-last where first and last are the zero-based offsets of the first and last bytes to copy")
+	}
+	return rnge, nil
+}
+
+// copyObjectPart implements UploadPartCopy: the part is read from an existing
+// object, or a byte range of it, instead of from the request body.
+func (g *Yts3) copyObjectPart(bucket, object string, upload *multipartUpload, partNumber int, w http.ResponseWriter, r *http.Request) error {
+	source := r.Header.Get("x-amz-copy-source")
+	logrus.Infof("[MultipartUpload]copy part %d of %s /%s/%s,source:%s\n", partNumber, upload.ID, bucket, object, source)
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[MultipartUpload]copyObjectPart ErrAuthorization\n")
+		return err
+	}
+	srcBucket, srcKey, srcVersion, err := parseCopySource(source)
+	if err != nil {
+		return err
+	}
+	if err := g.authorize(r, srcBucket, srcKey, getObjectAction(srcVersion)); err != nil {
+		return err
+	}
+	rnge, err := parseCopySourceRange(r.Header.Get("x-amz-copy-source-range"))
+	if err != nil {
+		return err
+	}
+	head, err := g.headCopySource(publicKey, srcBucket, srcKey, srcVersion)
+	if err != nil {
+		return err
+	}
+	if err := checkCopySourceConditions(r.Header, head); err != nil {
+		logrus.Infof("[MultipartUpload]/%s/%s,copy source precondition failed\n", srcBucket, srcKey)
+		return err
+	}
+	if rnge != nil && rnge.End >= head.Size {
+		return ErrorMessagef(ErrInvalidRange, "Range specified is not valid for source object of size: %d", head.Size)
+	}
+	var srcObj *Object
+	if srcVersion == "" {
+		srcObj, err = g.storage.GetObject(publicKey, srcBucket, srcKey, rnge)
+	} else if g.versioned != nil {
+		srcObj, err = g.versioned.GetObjectVersion(publicKey, srcBucket, srcKey, srcVersion, rnge)
+	} else {
+		return ErrNotImplemented
+	}
+	if err != nil {
+		return err
+	}
+	if srcObj == nil {
+		logrus.Errorf("[MultipartUpload]unexpected nil object for key /%s/%s\n", srcBucket, srcKey)
+		return ErrInternal
+	}
+	defer srcObj.Contents.Close()
+	size := srcObj.Size
+	if rnge != nil {
+		if rnge.End >= srcObj.Size || srcObj.Range == nil {
+			return ErrorMessagef(ErrInvalidRange, "Range specified is not valid for source object of size: %d", srcObj.Size)
+		}
+		size = srcObj.Range.Length
+	}
+	if size > MaxUploadPartSize {
+		return ErrorMessagef(ErrInvalidRequest, "The specified copy source is larger than the maximum allowable size for a copy source: %d", MaxUploadPartSize)
+	}
+	rdr := &exactReader{inner: io.LimitReader(srcObj.Contents, size), remaining: size}
+	etag, err := upload.AddPart(bucket, object, partNumber, g.timeSource.Now(), rdr, size)
+	if err != nil {
+		logrus.Errorf("[MultipartUpload]copy part %d of %s ERR:%s\n", partNumber, upload.ID, err)
+		return err
+	}
+	if srcObj.VersionID != "" {
+		w.Header().Set("x-amz-copy-source-version-id", string(srcObj.VersionID))
+	}
+	return g.xmlEncoder(w).Encode(CopyPartResult{
+		ETag:         etag,
 		LastModified: NewContentTime(g.timeSource.Now()),
 	})
 }
+
+// exactReader fails with ErrIncompleteBody if inner ends before remaining
+// bytes have been read.
+type exactReader struct {
+	inner     io.Reader
+	remaining int64
+}
+
+func (e *exactReader) Read(p []byte) (n int, err error) {
+	n, err = e.inner.Read(p)
+	e.remaining -= int64(n)
+	if err == io.EOF && e.remaining > 0 {
+		return n, ErrIncompleteBody
+	}
+	return n, err
+}
@@ -3,26 +3,20 @@ package yts3
 import (
 	"encoding/xml"
 	"net/http"
-	"strings"
 
 	"github.com/sirupsen/logrus"
 )
 
 func (g *Yts3) deleteObject(bucket, object string, w http.ResponseWriter, r *http.Request) error {
 	logrus.Infof("[S3Delete]DELETE:%s%s\n", bucket, object)
-	Authorization := r.Header.Get("Authorization")
-	if Authorization == "" {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
 		logrus.Error("[S3Delete]ErrAuthorization\n")
-		return ErrAuthorization
-	}
-	publicKey := GetBetweenStr(Authorization, "YTA", "/")
-	content := publicKey[3:]
-	if len(content) > 50 {
-		publicKeyLength := strings.Index(content, ":")
-		contentNew := content[:publicKeyLength]
-		content = contentNew
+		return err
 	}
-	result, err := g.storage.DeleteObject(content, bucket, object)
+	unlock := g.lockObject(publicKey, bucket, object)
+	defer unlock()
+	result, err := g.storage.DeleteObject(publicKey, bucket, object)
 	if err != nil {
 		logrus.Errorf("[S3Delete]Error:%s\n", err)
 		return err
@@ -41,19 +35,12 @@ func (g *Yts3) deleteObject(bucket, object string, w http.ResponseWriter, r *htt
 
 func (g *Yts3) deleteBucket(bucket string, w http.ResponseWriter, r *http.Request) error {
 	logrus.Infof("[S3Delete]DELETE BUCKET:%s\n", bucket)
-	Authorization := r.Header.Get("Authorization")
-	if Authorization == "" {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
 		logrus.Error("[deleteBucket]ErrAuthorization\n")
-		return ErrAuthorization
-	}
-	publicKey := GetBetweenStr(Authorization, "YTA", "/")
-	content := publicKey[3:]
-	if len(content) > 50 {
-		publicKeyLength := strings.Index(content, ":")
-		contentNew := content[:publicKeyLength]
-		content = contentNew
+		return err
 	}
-	if err := g.storage.DeleteBucket(content, bucket); err != nil {
+	if err := g.storage.DeleteBucket(publicKey, bucket); err != nil {
 		logrus.Errorf("[S3Delete]Error Msg:%s\n", err)
 		return err
 	}
@@ -63,17 +50,10 @@ func (g *Yts3) deleteBucket(bucket string, w http.ResponseWriter, r *http.Reques
 
 func (g *Yts3) deleteMulti(bucket string, w http.ResponseWriter, r *http.Request) error {
 	logrus.Infof("[S3Delete]delete multi : %s\n", bucket)
-	Authorization := r.Header.Get("Authorization")
-	if Authorization == "" {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
 		logrus.Error("[S3Delete]delteMulti ErrAuthorization\n")
-		return ErrAuthorization
-	}
-	publicKey := GetBetweenStr(Authorization, "YTA", "/")
-	content := publicKey[3:]
-	if len(content) > 50 {
-		publicKeyLength := strings.Index(content, ":")
-		contentNew := content[:publicKeyLength]
-		content = contentNew
+		return err
 	}
 	var in DeleteRequest
 	defer r.Body.Close()
@@ -81,14 +61,24 @@ func (g *Yts3) deleteMulti(bucket string, w http.ResponseWriter, r *http.Request
 	if err := dc.Decode(&in); err != nil {
 		return ErrorMessage(ErrMalformedXML, err.Error())
 	}
-	keys := make([]string, len(in.Objects))
-	for i, o := range in.Objects {
-		keys[i] = o.Key
+	keys := make([]string, 0, len(in.Objects))
+	var denied []ErrorResult
+	for _, o := range in.Objects {
+		if err := g.authorize(r, bucket, o.Key, "s3:DeleteObject"); err != nil {
+			result := ErrorResultFromError(err)
+			result.Key, result.Message = o.Key, result.Code.Message()
+			denied = append(denied, result)
+			continue
+		}
+		keys = append(keys, o.Key)
 	}
-	out, err := g.storage.DeleteMulti(content, bucket, keys...)
+	unlock := g.lockObjects(publicKey, bucket, keys)
+	out, err := g.storage.DeleteMulti(publicKey, bucket, keys...)
+	unlock()
 	if err != nil {
 		return err
 	}
+	out.Error = append(out.Error, denied...)
 	if in.Quiet {
 		out.Deleted = nil
 	}
@@ -4,8 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
-	"strings"
+	"net/textproto"
 	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
@@ -23,17 +24,10 @@ func (g *Yts3) getObject(bucket, object string, versionID VersionID, w http.Resp
 		return errors.New("getObject request too frequently.\n")
 	}
 	logrus.Infof("[S3Download]GET OBJECT:/%s/%s\n", bucket, object)
-	Authorization := r.Header.Get("Authorization")
-	if Authorization == "" {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
 		logrus.Error("[S3Download]getObject ErrAuthorization\n")
-		return ErrAuthorization
-	}
-	publicKey := GetBetweenStr(Authorization, "YTA", "/")
-	content := publicKey[3:]
-	if len(content) > 50 {
-		publicKeyLength := strings.Index(content, ":")
-		contentNew := content[:publicKeyLength]
-		content = contentNew
+		return err
 	}
 	q := r.URL.Query()
 	prefix := prefixFromQuery(q)
@@ -41,13 +35,29 @@ func (g *Yts3) getObject(bucket, object string, versionID VersionID, w http.Resp
 	if err != nil {
 		return err
 	}
-	rnge, err := parseRangeHeader(r.Header.Get("Range"))
+	rnges, err := parseRangesHeader(r.Header.Get("Range"))
 	if err != nil {
 		return err
 	}
+	if g.maxRanges > 0 && len(rnges) > g.maxRanges {
+		return ErrorMessagef(ErrInvalidRange, "at most %d ranges can be requested at once", g.maxRanges)
+	}
+	// Several ranges are read from the object one by one.
+	var rnge *ObjectRangeRequest
+	if len(rnges) == 1 {
+		rnge = rnges[0]
+	}
 	var obj *Object
 	if versionID == "" {
-		obj, err = g.storage.GetObjectV2(content, bucket, object, rnge, &prefix, page)
+		obj, err = g.storage.GetObjectV2(publicKey, bucket, object, rnge, &prefix, page)
+		if err != nil {
+			return err
+		}
+	} else {
+		if g.versioned == nil {
+			return ErrNotImplemented
+		}
+		obj, err = g.versioned.GetObjectVersion(publicKey, bucket, object, versionID, rnge)
 		if err != nil {
 			return err
 		}
@@ -57,12 +67,22 @@ func (g *Yts3) getObject(bucket, object string, versionID VersionID, w http.Resp
 		return ErrInternal
 	}
 	defer obj.Contents.Close()
-
+	if done, err := g.writeConditionalResponse(obj, w, r); done || err != nil {
+		return err
+	}
 	if err := g.writeGetOrHeadObjectResponse(obj, w, r); err != nil {
 		return err
 	}
+	if len(rnges) > 1 {
+		if done, err := g.writeMultiRangeResponse(obj, rnges, w); done || err != nil {
+			return err
+		}
+	}
 	logrus.Infof("[S3Download]content length:%d\n", obj.Size)
 	obj.Range.writeHeader(obj.Size, w)
+	if obj.Range != nil {
+		w.WriteHeader(http.StatusPartialContent)
+	}
 	if _, err := io.Copy(w, obj.Contents); err != nil {
 		logrus.Errorf("[S3Download]Write err:%s\n", err)
 		return err
@@ -80,17 +100,10 @@ func (g *Yts3) headObject(bucket, object string, versionID VersionID, w http.Res
 		return errors.New("headObject request too frequently.\n")
 	}
 	logrus.Infof("[S3Download]HEAD OBJECT,Bucket:%s,Object:%s\n", bucket, object)
-	Authorization := r.Header.Get("Authorization")
-	if Authorization == "" {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
 		logrus.Error("[S3Download]headObject ErrAuthorization\n")
-		return ErrAuthorization
-	}
-	publicKey := GetBetweenStr(Authorization, "YTA", "/")
-	content := publicKey[3:]
-	if len(content) > 50 {
-		publicKeyLength := strings.Index(content, ":")
-		contentNew := content[:publicKeyLength]
-		content = contentNew
+		return err
 	}
 	q := r.URL.Query()
 	prefix := prefixFromQuery(q)
@@ -98,20 +111,35 @@ func (g *Yts3) headObject(bucket, object string, versionID VersionID, w http.Res
 	if err != nil {
 		return err
 	}
-	rnge, err := parseRangeHeader(r.Header.Get("Range"))
-	if err != nil {
-		return err
+	// Like S3, HEAD only answers for the first range and ignores a Range
+	// header it cannot parse.
+	var rnge *ObjectRangeRequest
+	if rnges, err := parseRangesHeader(r.Header.Get("Range")); err == nil && len(rnges) > 0 {
+		rnge = rnges[0]
 	}
 	var obj *Object
-	obj, err = g.storage.GetObjectV2(content, bucket, object, rnge, &prefix, page)
-	if err != nil {
-		return err
+	if versionID == "" {
+		obj, err = g.storage.GetObjectV2(publicKey, bucket, object, rnge, &prefix, page)
+		if err != nil {
+			return err
+		}
+	} else {
+		if g.versioned == nil {
+			return ErrNotImplemented
+		}
+		obj, err = g.versioned.HeadObjectVersion(publicKey, bucket, object, versionID)
+		if err != nil {
+			return err
+		}
 	}
 	if obj == nil {
 		logrus.Errorf("[S3Download]unexpected nil object for key ： %s%s\n", bucket, object)
 		return ErrInternal
 	}
 	defer obj.Contents.Close()
+	if done, err := g.writeConditionalResponse(obj, w, r); done || err != nil {
+		return err
+	}
 	if err := g.writeGetOrHeadObjectResponse(obj, w, r); err != nil {
 		return err
 	}
@@ -119,3 +147,54 @@ func (g *Yts3) headObject(bucket, object string, versionID VersionID, w http.Res
 	logrus.Infof("[S3Download]/%s/%s download successful.\n", bucket, object)
 	return nil
 }
+
+// writeMultiRangeResponse answers a request for several byte ranges with a
+// multipart/byteranges body, reading each range from the backend separately.
+// It reports false, leaving the full object to be sent, if the backend cannot
+// read ranges on demand.
+func (g *Yts3) writeMultiRangeResponse(obj *Object, rnges []*ObjectRangeRequest, w http.ResponseWriter) (bool, error) {
+	reader, ok := obj.Contents.(RangeReader)
+	if !ok {
+		return false, nil
+	}
+	var parts []*ObjectRange
+	for _, rnge := range rnges {
+		// Unsatisfiable ranges are left out, as long as one remains.
+		if part, err := rnge.Range(obj.Size); err == nil {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return true, ErrInvalidRange
+	}
+	contentType := obj.Metadata["Content-Type"]
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	mw := multipart.NewWriter(w)
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusPartialContent)
+	for _, part := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {contentType},
+			"Content-Range": {fmt.Sprintf("bytes %d-%d/%d", part.Start, part.Start+part.Length-1, obj.Size)},
+		})
+		if err != nil {
+			return true, err
+		}
+		rc, err := reader.ReadRange(part.Start, part.Length)
+		if err != nil {
+			logrus.Errorf("[S3Download]Read range %d-%d of %s err:%s\n", part.Start, part.Start+part.Length-1, obj.Name, err)
+			return true, err
+		}
+		_, err = io.CopyN(pw, rc, part.Length)
+		rc.Close()
+		if err != nil {
+			logrus.Errorf("[S3Download]Write err:%s\n", err)
+			return true, err
+		}
+	}
+	logrus.Infof("[S3Download]%s,%d ranges\n", obj.Name, len(parts))
+	return true, mw.Close()
+}
@@ -0,0 +1,120 @@
+package yts3
+
+import (
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MaxLifecycleRules is the number of rules S3 accepts in a lifecycle
+// configuration.
+const MaxLifecycleRules = 1000
+
+func (g *Yts3) routeLifecycle(bucket string, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getBucketLifecycle(bucket, w, r)
+	case "PUT":
+		return g.putBucketLifecycle(bucket, w, r)
+	case "DELETE":
+		return g.deleteBucketLifecycle(bucket, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+func (g *Yts3) getBucketLifecycle(bucket string, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Lifecycle]GET BUCKET LIFECYCLE:%s\n", bucket)
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Lifecycle]getBucketLifecycle ErrAuthorization\n")
+		return err
+	}
+	config, err := g.uploader.Lifecycle(publicKey, bucket)
+	if err != nil {
+		return err
+	}
+	return g.xmlEncoder(w).Encode(config)
+}
+
+func (g *Yts3) putBucketLifecycle(bucket string, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Lifecycle]PUT BUCKET LIFECYCLE:%s\n", bucket)
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Lifecycle]putBucketLifecycle ErrAuthorization\n")
+		return err
+	}
+	var in LifecycleConfiguration
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := validateLifecycle(&in); err != nil {
+		return err
+	}
+	if g.configs == nil {
+		// Kept by the gateway, which does not know the buckets otherwise.
+		if err := g.ensureBucketExists(publicKey, bucket); err != nil {
+			return err
+		}
+	}
+	return g.uploader.SetLifecycle(publicKey, bucket, &in)
+}
+
+func (g *Yts3) deleteBucketLifecycle(bucket string, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Lifecycle]DELETE BUCKET LIFECYCLE:%s\n", bucket)
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Lifecycle]deleteBucketLifecycle ErrAuthorization\n")
+		return err
+	}
+	if err := g.uploader.DeleteLifecycle(publicKey, bucket); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// ensureBucketExists returns ErrNoSuchBucket unless the caller has bucket.
+func (g *Yts3) ensureBucketExists(publicKey, bucket string) error {
+	buckets, err := g.storage.ListBuckets(publicKey)
+	if err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		if b.Name == bucket {
+			return nil
+		}
+	}
+	return BucketNotFound(bucket)
+}
+
+func validateLifecycle(config *LifecycleConfiguration) error {
+	if len(config.Rules) == 0 || len(config.Rules) > MaxLifecycleRules {
+		return ErrMalformedXML
+	}
+	ids := make(map[string]bool)
+	for _, rule := range config.Rules {
+		if rule.ID != "" {
+			if ids[rule.ID] {
+				return ErrorMessage(ErrInvalidArgument, "Rule ID must be unique. Found same ID for more than one rule")
+			}
+			ids[rule.ID] = true
+		}
+		if rule.Status != LifecycleEnabled && rule.Status != LifecycleDisabled {
+			return ErrMalformedXML
+		}
+		if len(rule.Unsupported) > 0 {
+			return ErrorMessagef(ErrNotImplemented, "lifecycle action %s is not supported", rule.Unsupported[0].XMLName.Local)
+		}
+		if rule.Filter != nil && len(rule.Filter.Unsupported) > 0 {
+			return ErrorMessagef(ErrNotImplemented, "lifecycle filter %s is not supported", rule.Filter.Unsupported[0].XMLName.Local)
+		}
+		if rule.AbortIncompleteMultipartUpload == nil {
+			return ErrorMessage(ErrInvalidRequest, "At least one action needs to be specified in a rule")
+		}
+		if rule.AbortIncompleteMultipartUpload.DaysAfterInitiation <= 0 {
+			return ErrorMessage(ErrInvalidArgument, "DaysAfterInitiation for AbortIncompleteMultipartUpload action must be a positive integer")
+		}
+	}
+	return nil
+}
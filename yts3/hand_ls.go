@@ -4,7 +4,6 @@ import (
 	"encoding/base64"
 	"errors"
 	"net/http"
-	"strings"
 	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
@@ -20,17 +19,10 @@ func (g *Yts3) listBucket(bucketName string, w http.ResponseWriter, r *http.Requ
 	if count > int32(MaxListNum) {
 		return errors.New("listBucket request too frequently")
 	}
-	Authorization := r.Header.Get("Authorization")
-	if Authorization == "" {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
 		logrus.Error("[ListBucket]ErrAuthorization\n")
-		return ErrAuthorization
-	}
-	publicKey := GetBetweenStr(Authorization, "YTA", "/")
-	content := publicKey[3:]
-	if len(content) > 50 {
-		publicKeyLength := strings.Index(content, ":")
-		contentNew := content[:publicKeyLength]
-		content = contentNew
+		return err
 	}
 	q := r.URL.Query()
 	prefix := prefixFromQuery(q)
@@ -43,7 +35,7 @@ func (g *Yts3) listBucket(bucketName string, w http.ResponseWriter, r *http.Requ
 	}
 	isVersion2 := q.Get("list-type") == "2"
 	logrus.Infof("[ListBucket]Request bucketname:%s,prefix:%s,Marker:%s,HasMarker:%v,MaxKeys:%d\n", bucketName, prefix, page.Marker, page.HasMarker, page.MaxKeys)
-	objects, err := g.storage.ListBucket(content, bucketName, &prefix, page)
+	objects, err := g.storage.ListBucket(publicKey, bucketName, &prefix, page)
 	if err != nil {
 		return err
 	}
@@ -1,20 +1,21 @@
 package yts3
 
 import (
-	"errors"
 	"io"
 	"math"
 	"net/http"
 	"net/textproto"
-	"os"
 	"strconv"
-	"strings"
 
 	"github.com/sirupsen/logrus"
-	"github.com/yottachain/YTCoreService/env"
 )
 
 func (g *Yts3) listMultipartUploads(bucket string, w http.ResponseWriter, r *http.Request) error {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[MultipartUpload]listMultipartUploads ErrAuthorization\n")
+		return err
+	}
 	query := r.URL.Query()
 	prefix := prefixFromQuery(query)
 	marker := uploadListMarkerFromQuery(query)
@@ -25,7 +26,7 @@ func (g *Yts3) listMultipartUploads(bucket string, w http.ResponseWriter, r *htt
 	if maxUploads == 0 {
 		maxUploads = DefaultMaxUploads
 	}
-	out, err := g.uploader.List(bucket, marker, prefix, maxUploads)
+	out, err := g.uploader.List(publicKey, bucket, marker, prefix, maxUploads)
 	if err != nil {
 		return err
 	}
@@ -34,29 +35,20 @@ func (g *Yts3) listMultipartUploads(bucket string, w http.ResponseWriter, r *htt
 
 func (g *Yts3) initiateMultipartUpload(bucket, object string, w http.ResponseWriter, r *http.Request) error {
 	logrus.Infof("[MultipartUpload]initiate multipart upload\n")
-	s3cache := env.GetS3Cache()
-	directory := s3cache + "/" + bucket + "/"
-	s, err := os.Stat(directory)
+	publicKey, err := requestPublicKey(r)
 	if err != nil {
-		if !os.IsExist(err) {
-			err = os.MkdirAll(directory, os.ModePerm)
-			if err != nil {
-				return err
-			}
-		} else {
-			return err
-		}
-	} else {
-		if !s.IsDir() {
-			return errors.New("The specified path is not a directory.")
-		}
+		logrus.Error("[MultipartUpload]initiateMultipartUpload ErrAuthorization\n")
+		return err
 	}
 	meta, err := metadataHeaders(r.Header, g.timeSource.Now(), g.metadataSizeLimit)
 	if err != nil {
 		logrus.Errorf("[MultipartUpload]metadataHeaders err::::: %s\n", err)
 		return err
 	}
-	upload := g.uploader.Begin(bucket, object, meta, g.timeSource.Now())
+	upload, err := g.uploader.Begin(publicKey, bucket, object, meta, g.timeSource.Now())
+	if err != nil {
+		return err
+	}
 	out := InitiateMultipartUpload{
 		UploadID: upload.ID,
 		Bucket:   bucket,
@@ -67,17 +59,10 @@ func (g *Yts3) initiateMultipartUpload(bucket, object string, w http.ResponseWri
 
 func (g *Yts3) completeMultipartUpload(bucket, object string, uploadID UploadID, w http.ResponseWriter, r *http.Request) error {
 	logrus.Infof("[MultipartUpload]complete multipart upload %s %s %s\n", bucket, object, uploadID)
-	Authorization := r.Header.Get("Authorization")
-	if Authorization == "" {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
 		logrus.Error("[MultipartUpload]completeMultipartUpload ErrAuthorization\n")
-		return ErrAuthorization
-	}
-	publicKey := GetBetweenStr(Authorization, "YTA", "/")
-	content := publicKey[3:]
-	if len(content) > 50 {
-		publicKeyLength := strings.Index(content, ":")
-		contentNew := content[:publicKeyLength]
-		content = contentNew
+		return err
 	}
 	var in CompleteMultipartUploadRequest
 	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
@@ -85,26 +70,35 @@ func (g *Yts3) completeMultipartUpload(bucket, object string, uploadID UploadID,
 		return err
 	}
 	defer r.Body.Close()
-	upload, err := g.uploader.Complete(bucket, object, uploadID)
+	upload, err := g.uploader.Get(publicKey, bucket, object, uploadID)
 	if err != nil {
 		logrus.Errorf("[MultipartUpload]upload complete ERR :%s\n", err)
 		return err
 	}
-	fileBody, etag, err := upload.Reassemble(&in)
+	// Reassemble marks the upload as completing, so that its parts cannot be
+	// changed, aborted or reaped while they are being stored.
+	files, size, etag, err := upload.Reassemble(&in)
+	if err != nil {
+		logrus.Errorf("[MultipartUpload]Reassemble %s ERR :%s\n", uploadID, err)
+		return err
+	}
+	unlock, err := g.lockWrite(publicKey, bucket, object, r)
 	if err != nil {
-		logrus.Errorf("[MultipartUpload]fileBody, etag ERR :%s\n", err)
+		upload.Resume()
 		return err
 	}
-	logrus.Info("[MultipartUpload]fileBody size %d\n", len(fileBody))
-	s3cache := env.GetS3Cache()
-	directory := s3cache + "/" + bucket + "/" + object
-	files, _, _ := ListDir(directory)
-	size, _ := DirSize(directory)
-	result, err := g.storage.MultipartUpload(content, bucket, object, files, size)
+	defer unlock()
+	logrus.Infof("[MultipartUpload]%s,%d parts,size %d\n", uploadID, len(files), size)
+	result, err := g.storage.MultipartUpload(publicKey, bucket, object, upload.Meta, files, size, etag)
 	if err != nil {
 		logrus.Errorf("[MultipartUpload]put boject ERR :%s\n", err)
+		upload.Resume()
 		return err
 	}
+	if err := g.uploader.Complete(publicKey, bucket, object, uploadID); err != nil {
+		logrus.Warnf("[MultipartUpload]Cleanup %s ERR :%s\n", uploadID, err)
+	}
+	g.applyPolicyGrants(r, publicKey, bucket, object)
 	if result.VersionID != "" {
 		w.Header().Set("x-amz-version-id", string(result.VersionID))
 	}
@@ -116,6 +110,11 @@ func (g *Yts3) completeMultipartUpload(bucket, object string, uploadID UploadID,
 }
 
 func (g *Yts3) listMultipartUploadParts(bucket, object string, uploadID UploadID, w http.ResponseWriter, r *http.Request) error {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[MultipartUpload]listMultipartUploadParts ErrAuthorization\n")
+		return err
+	}
 	query := r.URL.Query()
 	marker, err := parseClampedInt(query.Get("part-number-marker"), 0, 0, math.MaxInt64)
 	if err != nil {
@@ -127,7 +126,7 @@ func (g *Yts3) listMultipartUploadParts(bucket, object string, uploadID UploadID
 		logrus.Errorf("[MultipartUpload]parseClampedInt Error Msg:%s\n", err)
 		return ErrInvalidURI
 	}
-	out, err := g.uploader.ListParts(bucket, object, uploadID, int(marker), maxParts)
+	out, err := g.uploader.ListParts(publicKey, bucket, object, uploadID, int(marker), maxParts)
 	if err != nil {
 		logrus.Errorf("[MultipartUpload]ListParts Error Msg:%s\n", err)
 		return err
@@ -136,33 +135,29 @@ func (g *Yts3) listMultipartUploadParts(bucket, object string, uploadID UploadID
 }
 
 func (g *Yts3) putMultipartUploadPart(bucket, object string, uploadID UploadID, w http.ResponseWriter, r *http.Request) error {
-	Authorization := r.Header.Get("Authorization")
-	if Authorization == "" {
-		logrus.Error("[MultipartUpload]ErrAuthorization\n")
-		return ErrAuthorization
-	}
-	publicKey := GetBetweenStr(Authorization, "YTA", "/")
-	content := publicKey[3:]
-	if len(content) > 50 {
-		publicKeyLength := strings.Index(content, ":")
-		contentNew := content[:publicKeyLength]
-		content = contentNew
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[MultipartUpload]putMultipartUploadPart ErrAuthorization\n")
+		return err
 	}
 	partNumber, err := strconv.ParseInt(r.URL.Query().Get("partNumber"), 10, 0)
 	if err != nil || partNumber <= 0 || partNumber > MaxUploadPartNumber {
 		logrus.Errorf("[MultipartUpload]Parse partNumber err:\n", err)
 		return ErrInvalidPart
 	}
-	size, err := strconv.ParseInt(r.Header.Get("Content-Length"), 10, 64)
-	if err != nil || size <= 0 {
-		return ErrMissingContentLength
-	}
-	upload, err := g.uploader.Get(bucket, object, uploadID)
+	upload, err := g.uploader.Get(publicKey, bucket, object, uploadID)
 	if err != nil {
 		logrus.Errorf("[MultipartUpload]uploader.Get Error Msg:%s\n", err)
 		return err
 	}
 	defer r.Body.Close()
+	if r.Header.Get("x-amz-copy-source") != "" {
+		return g.copyObjectPart(bucket, object, upload, int(partNumber), w, r)
+	}
+	size, err := requestContentLength(r)
+	if err != nil || size <= 0 {
+		return ErrMissingContentLength
+	}
 	var rdr io.Reader = r.Body
 	if g.integrityCheck {
 		md5Base64 := r.Header.Get("Content-MD5")
@@ -186,8 +181,13 @@ func (g *Yts3) putMultipartUploadPart(bucket, object string, uploadID UploadID,
 }
 
 func (g *Yts3) abortMultipartUpload(bucket, object string, uploadID UploadID, w http.ResponseWriter, r *http.Request) error {
-	logrus.Infof("[MultipartUpload]abort multipart upload : %s %s %d\n", bucket, object, uploadID)
-	if _, err := g.uploader.Complete(bucket, object, uploadID); err != nil {
+	logrus.Infof("[MultipartUpload]abort multipart upload : %s %s %s\n", bucket, object, uploadID)
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[MultipartUpload]abortMultipartUpload ErrAuthorization\n")
+		return err
+	}
+	if err := g.uploader.Abort(publicKey, bucket, object, uploadID); err != nil {
 		return err
 	}
 	w.WriteHeader(http.StatusNoContent)
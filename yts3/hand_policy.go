@@ -0,0 +1,363 @@
+package yts3
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+func (g *Yts3) routeBucketPolicy(bucket string, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getBucketPolicy(bucket, w, r)
+	case "PUT":
+		return g.putBucketPolicy(bucket, w, r)
+	case "DELETE":
+		return g.deleteBucketPolicy(bucket, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+func (g *Yts3) getBucketPolicy(bucket string, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Policy]GET BUCKET POLICY:%s\n", bucket)
+	if g.configs == nil {
+		return ErrNotImplemented
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Policy]getBucketPolicy ErrAuthorization\n")
+		return err
+	}
+	doc, err := g.configs.BucketConfig(publicKey, bucket, BucketConfigPolicy)
+	if err != nil {
+		return err
+	}
+	if doc == nil {
+		return ResourceError(ErrNoSuchBucketPolicy, bucket)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(doc)
+	return err
+}
+
+func (g *Yts3) putBucketPolicy(bucket string, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Policy]PUT BUCKET POLICY:%s\n", bucket)
+	if g.configs == nil {
+		return ErrNotImplemented
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Policy]putBucketPolicy ErrAuthorization\n")
+		return err
+	}
+	doc, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxBucketPolicySize+1))
+	if err != nil {
+		return err
+	}
+	if len(doc) > MaxBucketPolicySize {
+		return ErrorMessagef(ErrMalformedPolicy, "Policies must be less than %d bytes", MaxBucketPolicySize)
+	}
+	policy, err := parsePolicy(bucket, doc)
+	if err != nil {
+		logrus.Errorf("[Policy]%s policy err:%s\n", bucket, err)
+		return err
+	}
+	owner := IdentityFromContext(r.Context())
+	grants, err := policy.checkGrants(owner)
+	if err != nil {
+		logrus.Errorf("[Policy]%s policy err:%s\n", bucket, err)
+		return err
+	}
+	if grants && g.acls == nil {
+		return ErrorMessage(ErrNotImplemented, "other accounts can only be allowed where the Backend keeps object ACLs")
+	}
+	if err := g.configs.SetBucketConfig(publicKey, bucket, BucketConfigPolicy, doc); err != nil {
+		return err
+	}
+	if grants {
+		if err := g.licenseBucket(publicKey, owner, bucket, policy); err != nil {
+			return err
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *Yts3) deleteBucketPolicy(bucket string, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Policy]DELETE BUCKET POLICY:%s\n", bucket)
+	if g.configs == nil {
+		return ErrNotImplemented
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Policy]deleteBucketPolicy ErrAuthorization\n")
+		return err
+	}
+	if err := g.configs.SetBucketConfig(publicKey, bucket, BucketConfigPolicy, nil); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// authorizeRequest checks the request against the policy of its bucket
+// before it is routed. Requests whose action depends on the body, such as
+// DeleteObjects, are checked by their handler instead.
+func (g *Yts3) authorizeRequest(bucket, object string, r *http.Request) error {
+	action := requestAction(bucket, object, r)
+	if action == "" {
+		return nil
+	}
+	return g.authorize(r, bucket, object, action)
+}
+
+// authorize evaluates the policy of bucket for action on the bucket, or on
+// object if it is not empty. Every request is served from the caller's own
+// buckets, so the caller is the bucket owner: it is allowed unless a
+// statement of the policy denies it. The owner can always manage the policy
+// itself, so that a policy cannot lock it out. Allow statements naming
+// other accounts are not evaluated here; the objects they cover are
+// licensed to those accounts instead, see licenseObject.
+func (g *Yts3) authorize(r *http.Request, bucket, object, action string) error {
+	if g.configs == nil || bucket == "" || strings.HasSuffix(action, "BucketPolicy") {
+		return nil
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		// Left to the handler to reject.
+		return nil
+	}
+	doc, err := g.configs.BucketConfig(publicKey, bucket, BucketConfigPolicy)
+	if err != nil {
+		if HasErrorCode(err, ErrNoSuchBucket) {
+			return nil
+		}
+		return err
+	}
+	if doc == nil {
+		return nil
+	}
+	policy, err := parsePolicy(bucket, doc)
+	if err != nil {
+		logrus.Errorf("[Policy]%s stored policy err:%s\n", bucket, err)
+		return err
+	}
+	req := &policyRequest{
+		action:     action,
+		resource:   resourceARN(bucket, object),
+		identity:   IdentityFromContext(r.Context()),
+		conditions: requestConditions(r),
+	}
+	if policy.evaluate(req) == policyDeny {
+		logrus.Infof("[Policy]%s %s denied\n", action, req.resource)
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// requestAction returns the policy action of a request, as routed by
+// routeBase, or "" if it is checked by its handler.
+func requestAction(bucket, object string, r *http.Request) string {
+	if bucket == "" {
+		return ""
+	}
+	q := r.URL.Query()
+	has := func(key string) bool {
+		_, ok := q[key]
+		return ok
+	}
+	versioned := versionFromQuery(q["versionId"]) != ""
+	if object == "" {
+		switch r.Method {
+		case "GET", "HEAD":
+			switch {
+			case has("uploads"):
+				return "s3:ListBucketMultipartUploads"
+			case has("versioning"):
+				return "s3:GetBucketVersioning"
+			case has("versions"):
+				return "s3:ListBucketVersions"
+			case has("lifecycle"):
+				return "s3:GetLifecycleConfiguration"
+			case has("tagging"):
+				return "s3:GetBucketTagging"
+			case has("policy"):
+				return "s3:GetBucketPolicy"
+			case has("location"):
+				return "s3:GetBucketLocation"
+			case has("acl"):
+				return "s3:GetBucketAcl"
+			}
+			return "s3:ListBucket"
+		case "PUT":
+			switch {
+			case has("versioning"):
+				return "s3:PutBucketVersioning"
+			case has("lifecycle"):
+				return "s3:PutLifecycleConfiguration"
+			case has("tagging"):
+				return "s3:PutBucketTagging"
+			case has("policy"):
+				return "s3:PutBucketPolicy"
+			case has("acl"):
+				return "s3:PutBucketAcl"
+			}
+			return "s3:CreateBucket"
+		case "DELETE":
+			switch {
+			case has("lifecycle"):
+				return "s3:PutLifecycleConfiguration"
+			case has("tagging"):
+				return "s3:PutBucketTagging"
+			case has("policy"):
+				return "s3:DeleteBucketPolicy"
+			}
+			return "s3:DeleteBucket"
+		}
+		// POST uploads and deletes name their keys in the body.
+		return ""
+	}
+	switch r.Method {
+	case "GET", "HEAD":
+		switch {
+		case has("uploadId"):
+			return "s3:ListMultipartUploadParts"
+		case has("tagging") && versioned:
+			return "s3:GetObjectVersionTagging"
+		case has("tagging"):
+			return "s3:GetObjectTagging"
+		case has("acl") && versioned:
+			return "s3:GetObjectVersionAcl"
+		case has("acl"):
+			return "s3:GetObjectAcl"
+		case versioned:
+			return "s3:GetObjectVersion"
+		}
+		return "s3:GetObject"
+	case "PUT":
+		switch {
+		case has("tagging") && versioned:
+			return "s3:PutObjectVersionTagging"
+		case has("tagging"):
+			return "s3:PutObjectTagging"
+		case has("acl") && versioned:
+			return "s3:PutObjectVersionAcl"
+		case has("acl"):
+			return "s3:PutObjectAcl"
+		}
+		return "s3:PutObject"
+	case "DELETE":
+		switch {
+		case has("uploadId"):
+			return "s3:AbortMultipartUpload"
+		case has("tagging") && versioned:
+			return "s3:DeleteObjectVersionTagging"
+		case has("tagging"):
+			return "s3:DeleteObjectTagging"
+		case versioned:
+			return "s3:DeleteObjectVersion"
+		}
+		return "s3:DeleteObject"
+	case "POST":
+		return "s3:PutObject"
+	}
+	return ""
+}
+
+// getObjectAction returns the action that reads an object, or a version of
+// it.
+func getObjectAction(versionID VersionID) string {
+	if versionID != "" {
+		return "s3:GetObjectVersion"
+	}
+	return "s3:GetObject"
+}
+
+// licenseBucket licenses every object of bucket that policy allows other
+// accounts to read to them. A licence cannot be taken back, so objects stay
+// licensed when the policy is changed or deleted.
+func (g *Yts3) licenseBucket(publicKey string, owner *Identity, bucket string, policy *PolicyDocument) error {
+	page := ListBucketPage{MaxKeys: MaxBucketKeys}
+	for {
+		objects, err := g.storage.ListBucket(publicKey, bucket, &Prefix{}, page)
+		if err != nil {
+			return err
+		}
+		for _, content := range objects.Contents {
+			unlock := g.lockObject(publicKey, bucket, content.Key)
+			err := g.licenseObject(publicKey, owner, bucket, content.Key, policy)
+			unlock()
+			if err != nil {
+				return err
+			}
+		}
+		if !objects.IsTruncated || objects.NextMarker == "" {
+			return nil
+		}
+		page.Marker, page.HasMarker = objects.NextMarker, true
+	}
+}
+
+// licenseObject adds a READ grant to the ACL of object for every account
+// other than the owner that policy allows to read it. The Backend licenses
+// the object to them, as for a PUT ?acl. The caller must hold the key lock.
+func (g *Yts3) licenseObject(publicKey string, owner *Identity, bucket, object string, policy *PolicyDocument) error {
+	readers := policy.readers(owner, bucket, object)
+	if len(readers) == 0 {
+		return nil
+	}
+	acl, err := g.acls.ObjectACL(publicKey, bucket, object, "")
+	if err != nil {
+		return err
+	}
+	if acl == nil {
+		acl = defaultACL(publicKey)
+	}
+	acl.Owner = ownerInfo(publicKey)
+	granted := make(map[string]bool)
+	for _, id := range acl.Readers() {
+		granted[id] = true
+	}
+	changed := false
+	for _, id := range readers {
+		if granted[id] {
+			continue
+		}
+		acl.AccessControlList.Grants = append(acl.AccessControlList.Grants, Grant{
+			Grantee:    Grantee{Type: GranteeCanonicalUser, ID: id},
+			Permission: PermissionRead,
+		})
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	logrus.Infof("[Policy]/%s/%s,licensed to %s\n", bucket, object, strings.Join(readers, ","))
+	return g.acls.SetObjectACL(publicKey, bucket, object, "", acl)
+}
+
+// applyPolicyGrants licenses an object that has just been written to the
+// accounts the policy of its bucket allows to read it. The write has
+// succeeded by then, so failures are only logged; putting the policy again
+// licenses the objects that were missed. The caller must hold the key lock.
+func (g *Yts3) applyPolicyGrants(r *http.Request, publicKey, bucket, object string) {
+	if g.configs == nil || g.acls == nil {
+		return
+	}
+	doc, err := g.configs.BucketConfig(publicKey, bucket, BucketConfigPolicy)
+	if err != nil || doc == nil {
+		return
+	}
+	policy, err := parsePolicy(bucket, doc)
+	if err != nil {
+		logrus.Errorf("[Policy]%s stored policy err:%s\n", bucket, err)
+		return
+	}
+	if err := g.licenseObject(publicKey, IdentityFromContext(r.Context()), bucket, object, policy); err != nil {
+		logrus.Errorf("[Policy]/%s/%s,license err:%s\n", bucket, object, err)
+	}
+}
@@ -0,0 +1,279 @@
+package yts3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// TaggingMetaKey is the meta entry that holds the tag set of an object,
+	// in the URL query form of the x-amz-tagging header.
+	TaggingMetaKey = "X-Amz-Tagging"
+
+	// From the docs: "You can associate up to 10 tags with an object. Tags
+	// that are associated with an object must have unique tag keys."
+	MaxObjectTags = 10
+
+	// From the docs: "You can associate up to 50 tags with a bucket."
+	MaxBucketTags = 50
+
+	// From the docs: "A tag key can be up to 128 Unicode characters in
+	// length, and tag values can be up to 256 Unicode characters in length."
+	MaxTagKeyLength   = 128
+	MaxTagValueLength = 256
+)
+
+func (g *Yts3) routeObjectTagging(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getObjectTagging(bucket, object, versionID, w, r)
+	case "PUT":
+		return g.putObjectTagging(bucket, object, versionID, w, r)
+	case "DELETE":
+		return g.deleteObjectTagging(bucket, object, versionID, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+func (g *Yts3) getObjectTagging(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Tagging]GET OBJECT TAGGING:%s/%s,%s\n", bucket, object, versionID)
+	if g.tagging == nil {
+		return ErrNotImplemented
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Tagging]getObjectTagging ErrAuthorization\n")
+		return err
+	}
+	tagging, err := g.tagging.ObjectTagging(publicKey, bucket, object, versionID)
+	if err != nil {
+		return err
+	}
+	if versionID != "" {
+		w.Header().Set("x-amz-version-id", string(versionID))
+	}
+	return g.xmlEncoder(w).Encode(tagging)
+}
+
+func (g *Yts3) putObjectTagging(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Tagging]PUT OBJECT TAGGING:%s/%s,%s\n", bucket, object, versionID)
+	if g.tagging == nil {
+		return ErrNotImplemented
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Tagging]putObjectTagging ErrAuthorization\n")
+		return err
+	}
+	var in Tagging
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := validateTagging(&in, MaxObjectTags); err != nil {
+		return err
+	}
+	unlock := g.lockObject(publicKey, bucket, object)
+	defer unlock()
+	if err := g.tagging.SetObjectTagging(publicKey, bucket, object, versionID, in); err != nil {
+		return err
+	}
+	if versionID != "" {
+		w.Header().Set("x-amz-version-id", string(versionID))
+	}
+	return nil
+}
+
+func (g *Yts3) deleteObjectTagging(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Tagging]DELETE OBJECT TAGGING:%s/%s,%s\n", bucket, object, versionID)
+	if g.tagging == nil {
+		return ErrNotImplemented
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Tagging]deleteObjectTagging ErrAuthorization\n")
+		return err
+	}
+	unlock := g.lockObject(publicKey, bucket, object)
+	defer unlock()
+	if err := g.tagging.SetObjectTagging(publicKey, bucket, object, versionID, Tagging{}); err != nil {
+		return err
+	}
+	if versionID != "" {
+		w.Header().Set("x-amz-version-id", string(versionID))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *Yts3) routeBucketTagging(bucket string, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getBucketTagging(bucket, w, r)
+	case "PUT":
+		return g.putBucketTagging(bucket, w, r)
+	case "DELETE":
+		return g.deleteBucketTagging(bucket, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+func (g *Yts3) getBucketTagging(bucket string, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Tagging]GET BUCKET TAGGING:%s\n", bucket)
+	if g.configs == nil {
+		return ErrNotImplemented
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Tagging]getBucketTagging ErrAuthorization\n")
+		return err
+	}
+	doc, err := g.configs.BucketConfig(publicKey, bucket, BucketConfigTagging)
+	if err != nil {
+		return err
+	}
+	if doc == nil {
+		return ResourceError(ErrNoSuchTagSet, bucket)
+	}
+	var tagging Tagging
+	if err := xml.Unmarshal(doc, &tagging); err != nil {
+		logrus.Errorf("[Tagging]%s stored tagging err:%s\n", bucket, err)
+		return err
+	}
+	return g.xmlEncoder(w).Encode(tagging)
+}
+
+func (g *Yts3) putBucketTagging(bucket string, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Tagging]PUT BUCKET TAGGING:%s\n", bucket)
+	if g.configs == nil {
+		return ErrNotImplemented
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Tagging]putBucketTagging ErrAuthorization\n")
+		return err
+	}
+	var in Tagging
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := validateTagging(&in, MaxBucketTags); err != nil {
+		return err
+	}
+	doc, err := xml.Marshal(&in)
+	if err != nil {
+		return err
+	}
+	if err := g.configs.SetBucketConfig(publicKey, bucket, BucketConfigTagging, doc); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *Yts3) deleteBucketTagging(bucket string, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Tagging]DELETE BUCKET TAGGING:%s\n", bucket)
+	if g.configs == nil {
+		return ErrNotImplemented
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Tagging]deleteBucketTagging ErrAuthorization\n")
+		return err
+	}
+	if err := g.configs.SetBucketConfig(publicKey, bucket, BucketConfigTagging, nil); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// ParseTagging parses a tag set in the URL query form of the x-amz-tagging
+// header, as it is also kept in the TaggingMetaKey meta entry.
+func ParseTagging(s string) (Tagging, error) {
+	var tagging Tagging
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return tagging, ErrorMessage(ErrInvalidTag, "The header 'x-amz-tagging' shall be encoded as UTF-8 then URLEncoded URL query parameters without tag name duplicates.")
+	}
+	keys := make([]string, 0, len(values))
+	for k, v := range values {
+		if len(v) > 1 {
+			return tagging, ErrorMessage(ErrInvalidTag, "Cannot provide multiple Tags with the same key")
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		tagging.TagSet.Tags = append(tagging.TagSet.Tags, Tag{Key: k, Value: values[k][0]})
+	}
+	return tagging, nil
+}
+
+// Encode returns the tag set in the URL query form read by ParseTagging.
+func (t Tagging) Encode() string {
+	values := make(url.Values)
+	for _, tag := range t.TagSet.Tags {
+		values.Set(tag.Key, tag.Value)
+	}
+	return values.Encode()
+}
+
+func validateTagging(tagging *Tagging, maxTags int) error {
+	if len(tagging.TagSet.Tags) > maxTags {
+		return ErrorMessagef(ErrInvalidTag, "Cannot have more than %d tags", maxTags)
+	}
+	keys := make(map[string]bool)
+	for _, tag := range tagging.TagSet.Tags {
+		if tag.Key == "" || utf8.RuneCountInString(tag.Key) > MaxTagKeyLength {
+			return ErrorMessage(ErrInvalidTag, "The TagKey you have provided is invalid")
+		}
+		if utf8.RuneCountInString(tag.Value) > MaxTagValueLength {
+			return ErrorMessage(ErrInvalidTag, "The TagValue you have provided is invalid")
+		}
+		if keys[tag.Key] {
+			return ErrorMessage(ErrInvalidTag, "Cannot provide multiple Tags with the same key")
+		}
+		keys[tag.Key] = true
+	}
+	return nil
+}
+
+// normalizeTaggingHeader validates the x-amz-tagging header of an upload, as
+// collected in meta, and rewrites it into the form that is stored.
+func normalizeTaggingHeader(meta map[string]string) error {
+	v, ok := meta[TaggingMetaKey]
+	if !ok {
+		return nil
+	}
+	tagging, err := ParseTagging(v)
+	if err != nil {
+		return err
+	}
+	if err := validateTagging(&tagging, MaxObjectTags); err != nil {
+		return err
+	}
+	if len(tagging.TagSet.Tags) == 0 {
+		delete(meta, TaggingMetaKey)
+	} else {
+		meta[TaggingMetaKey] = tagging.Encode()
+	}
+	return nil
+}
+
+// taggingCount returns the x-amz-tagging-count of an object with the given
+// meta, or "" if it has no tags.
+func taggingCount(meta map[string]string) string {
+	tagging, err := ParseTagging(meta[TaggingMetaKey])
+	if err != nil || len(tagging.TagSet.Tags) == 0 {
+		return ""
+	}
+	return strconv.Itoa(len(tagging.TagSet.Tags))
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/hex"
 	"net/http"
 	"net/textproto"
-	"strconv"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -14,21 +13,11 @@ import (
 )
 
 func (g *Yts3) createObject(bucket, object string, w http.ResponseWriter, r *http.Request) (err error) {
-	if r.URL.RawQuery == "acl=" {
-		return nil
-	}
 	logrus.Infof("[S3Upload]CREATE OBJECT:%s/%s\n", bucket, object)
-	Authorization := r.Header.Get("Authorization")
-	if Authorization == "" {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
 		logrus.Error("[[S3Upload]]ErrAuthorization\n")
-		return ErrAuthorization
-	}
-	publicKey := GetBetweenStr(Authorization, "YTA", "/")
-	content := publicKey[3:]
-	if len(content) > 50 {
-		publicKeyLength := strings.Index(content, ":")
-		contentNew := content[:publicKeyLength]
-		content = contentNew
+		return err
 	}
 	meta, err := metadataHeaders(r.Header, g.timeSource.Now(), g.metadataSizeLimit)
 	if err != nil {
@@ -37,20 +26,7 @@ func (g *Yts3) createObject(bucket, object string, w http.ResponseWriter, r *htt
 	if _, ok := meta["X-Amz-Copy-Source"]; ok {
 		return g.copyObject(bucket, object, meta, w, r)
 	}
-	contentLength := r.Header.Get("Content-Length")
-	/*
-		if contentLength == "" {
-			return ErrMissingContentLength
-		} else if contentLength == "154" {
-			var rdr io.Reader = r.Body
-			lnn := 10485760
-			body, err := ReadAll(rdr, int64(lnn))
-			if err != nil {
-				contentLength = fmt.Sprintf("%d", len(body))
-			}
-		}
-	*/
-	size, err := strconv.ParseInt(contentLength, 10, 64)
+	size, err := requestContentLength(r)
 	if err != nil || size < 0 {
 		w.WriteHeader(http.StatusBadRequest)
 		return nil
@@ -69,10 +45,15 @@ func (g *Yts3) createObject(bucket, object string, w http.ResponseWriter, r *htt
 	if err != nil {
 		return err
 	}
+	unlock, err := g.lockWrite(publicKey, bucket, object, r)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	uri := r.URL.Path
 	if strings.HasSuffix(uri, "/") || size == 0 {
 		var bts []byte
-		metazero := make(map[string]string)
+		metazero := ObjectMetadata(meta)
 		hashz := md5.Sum(bts)
 		metazero["ETag"] = hex.EncodeToString(hashz[:])
 		metazero["contentLength"] = "0"
@@ -81,39 +62,33 @@ func (g *Yts3) createObject(bucket, object string, w http.ResponseWriter, r *htt
 			logrus.Errorf("[S3Upload]FileMetaMapTobytes err:%s\n", err2)
 			return
 		}
-		c := api.GetClient(content)
+		c := api.GetClient(publicKey)
 		errzero := c.NewObjectAccessor().CreateObject(bucket, object, env.ZeroLenFileID(), metadata2)
 		if errzero != nil {
 			logrus.Errorf("[S3Upload]Save meta err:%s\n", errzero)
 			return
 		}
 	} else {
-		result, err := g.storage.PutObject(content, bucket, object, meta, rdr, size)
+		result, err := g.storage.PutObject(publicKey, bucket, object, meta, rdr, size)
 		if err != nil {
 			return err
 		}
 		if result.VersionID != "" {
-			logrus.Infof("[S3Upload]CREATED VERSION:%s%s%d\n", bucket, object, result.VersionID)
+			logrus.Infof("[S3Upload]CREATED VERSION:/%s/%s,%s\n", bucket, object, result.VersionID)
 			w.Header().Set("x-amz-version-id", string(result.VersionID))
 		}
 	}
+	g.applyPolicyGrants(r, publicKey, bucket, object)
 	w.Header().Set("ETag", `"`+hex.EncodeToString(rdr.Sum(nil))+`"`)
 	return nil
 }
 
 func (g *Yts3) createObjectBrowserUpload(bucket string, w http.ResponseWriter, r *http.Request) error {
 	logrus.Infof("[S3Upload]CREATE OBJECT THROUGH BROWSER UPLOAD\n")
-	Authorization := r.Header.Get("Authorization")
-	if Authorization == "" {
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
 		logrus.Error("[S3Upload]createObjectBrowserUpload ErrAuthorization\n")
-		return ErrAuthorization
-	}
-	publicKey := GetBetweenStr(Authorization, "YTA", "/")
-	content := publicKey[3:]
-	if len(content) > 50 {
-		publicKeyLength := strings.Index(content, ":")
-		contentNew := content[:publicKeyLength]
-		content = contentNew
+		return err
 	}
 	const _24MB = (1 << 20) * 24
 	if err := r.ParseMultipartForm(_24MB); nil != err {
@@ -125,6 +100,9 @@ func (g *Yts3) createObjectBrowserUpload(bucket string, w http.ResponseWriter, r
 	}
 	key := keyValues[0]
 	logrus.Infof("[S3Upload](BUC)%s,(KEY)%s\n", bucket, key)
+	if err := g.authorize(r, bucket, key, "s3:PutObject"); err != nil {
+		return err
+	}
 	fileValues := r.MultipartForm.File["file"]
 	if len(fileValues) != 1 {
 		return ErrIncorrectNumberOfFilesInPostRequest
@@ -146,10 +124,13 @@ func (g *Yts3) createObjectBrowserUpload(bucket string, w http.ResponseWriter, r
 	if err != nil {
 		return err
 	}
-	result, err := g.storage.PutObject(content, bucket, key, meta, rdr, fileHeader.Size)
+	unlock := g.lockObject(publicKey, bucket, key)
+	defer unlock()
+	result, err := g.storage.PutObject(publicKey, bucket, key, meta, rdr, fileHeader.Size)
 	if err != nil {
 		return err
 	}
+	g.applyPolicyGrants(r, publicKey, bucket, key)
 	if result.VersionID != "" {
 		w.Header().Set("x-amz-version-id", string(result.VersionID))
 	}
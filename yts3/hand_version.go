@@ -0,0 +1,143 @@
+package yts3
+
+import (
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+func (g *Yts3) routeVersioning(bucket string, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getBucketVersioning(bucket, w, r)
+	case "PUT":
+		return g.putBucketVersioning(bucket, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+func (g *Yts3) routeVersions(bucket string, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.listBucketVersions(bucket, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+func (g *Yts3) routeVersion(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	if _, ok := r.URL.Query()["tagging"]; ok {
+		return g.routeObjectTagging(bucket, object, versionID, w, r)
+	}
+	if _, ok := r.URL.Query()["acl"]; ok {
+		return g.routeObjectACL(bucket, object, versionID, w, r)
+	}
+	switch r.Method {
+	case "GET":
+		return g.getObject(bucket, object, versionID, w, r)
+	case "HEAD":
+		return g.headObject(bucket, object, versionID, w, r)
+	case "DELETE":
+		return g.deleteObjectVersion(bucket, object, versionID, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+func (g *Yts3) getBucketVersioning(bucket string, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Versioning]GET BUCKET VERSIONING:%s\n", bucket)
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Versioning]getBucketVersioning ErrAuthorization\n")
+		return err
+	}
+	var config VersioningConfiguration
+	if g.versioned != nil {
+		config, err = g.versioned.VersioningConfiguration(publicKey, bucket)
+		if err != nil {
+			return err
+		}
+	}
+	return g.xmlEncoder(w).Encode(config)
+}
+
+func (g *Yts3) putBucketVersioning(bucket string, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[Versioning]PUT BUCKET VERSIONING:%s\n", bucket)
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[Versioning]putBucketVersioning ErrAuthorization\n")
+		return err
+	}
+	var in VersioningConfiguration
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if in.Status != VersioningEnabled && in.Status != VersioningSuspended {
+		return ResourceError(ErrIllegalVersioningConfiguration, bucket)
+	}
+	if in.MFADelete == MFADeleteEnabled {
+		return ErrNotImplemented
+	}
+	if g.versioned == nil {
+		if in.Status == VersioningEnabled {
+			return ErrNotImplemented
+		}
+		return nil
+	}
+	logrus.Infof("[Versioning]%s status:%s\n", bucket, in.Status)
+	return g.versioned.SetVersioningConfiguration(publicKey, bucket, in)
+}
+
+func (g *Yts3) deleteObjectVersion(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	logrus.Infof("[S3Delete]DELETE VERSION:%s/%s,%s\n", bucket, object, versionID)
+	if g.versioned == nil {
+		return ErrNotImplemented
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[S3Delete]deleteObjectVersion ErrAuthorization\n")
+		return err
+	}
+	result, err := g.versioned.DeleteObjectVersion(publicKey, bucket, object, versionID)
+	if err != nil {
+		logrus.Errorf("[S3Delete]Error:%s\n", err)
+		return err
+	}
+	if result.IsDeleteMarker {
+		w.Header().Set("x-amz-delete-marker", "true")
+	}
+	w.Header().Set("x-amz-version-id", string(result.VersionID))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *Yts3) listBucketVersions(bucket string, w http.ResponseWriter, r *http.Request) error {
+	if g.versioned == nil {
+		return ErrNotImplemented
+	}
+	publicKey, err := requestPublicKey(r)
+	if err != nil {
+		logrus.Error("[ListVersions]ErrAuthorization\n")
+		return err
+	}
+	q := r.URL.Query()
+	prefix := prefixFromQuery(q)
+	page, err := listBucketVersionsPageFromQuery(q)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("[ListVersions]Request bucketname:%s,%s,KeyMarker:%s,VersionIdMarker:%s,MaxKeys:%d\n", bucket, prefix, page.KeyMarker, page.VersionIDMarker, page.MaxKeys)
+	result, err := g.versioned.ListBucketVersions(publicKey, bucket, &prefix, &page)
+	if err != nil {
+		return err
+	}
+	for _, ver := range result.Versions {
+		// S3 reports objects written before versioning was enabled with
+		// the version ID 'null'.
+		if ver.GetVersionID() == "" {
+			ver.setVersionID("null")
+		}
+	}
+	return g.xmlEncoder(w).Encode(result)
+}
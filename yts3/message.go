@@ -123,8 +123,15 @@ type CompleteMultipartUploadRequest struct {
 	Parts []CompletedPart `xml:"Part"`
 }
 
+// partsAreSorted reports whether the parts are listed in strictly ascending
+// part number order, as S3 requires.
 func (c CompleteMultipartUploadRequest) partsAreSorted() bool {
-	return sort.IntsAreSorted(c.partIDs())
+	for i := 1; i < len(c.Parts); i++ {
+		if c.Parts[i].PartNumber <= c.Parts[i-1].PartNumber {
+			return false
+		}
+	}
+	return true
 }
 
 func (c CompleteMultipartUploadRequest) partIDs() []int {
@@ -186,6 +193,33 @@ type ListBucketVersionsResult struct {
 	prefixes map[string]bool
 }
 
+func NewListBucketVersionsResult(bucketName string, prefix *Prefix, page *ListBucketVersionsPage) *ListBucketVersionsResult {
+	result := &ListBucketVersionsResult{
+		Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/",
+		Name:  bucketName,
+	}
+	if prefix != nil {
+		result.Prefix = prefix.Prefix
+		result.Delimiter = prefix.Delimiter
+	}
+	if page != nil {
+		result.MaxKeys = page.MaxKeys
+		result.KeyMarker = page.KeyMarker
+		result.VersionIDMarker = page.VersionIDMarker
+	}
+	return result
+}
+
+func (b *ListBucketVersionsResult) AddPrefix(prefix string) {
+	if b.prefixes == nil {
+		b.prefixes = map[string]bool{}
+	} else if b.prefixes[prefix] {
+		return
+	}
+	b.prefixes[prefix] = true
+	b.CommonPrefixes = append(b.CommonPrefixes, CommonPrefix{Prefix: prefix})
+}
+
 type ListMultipartUploadsResult struct {
 	Bucket string `xml:"Bucket"`
 
@@ -247,6 +281,97 @@ type CopyObjectResult struct {
 	LastModified ContentTime `xml:"LastModified,omitempty"`
 }
 
+// Tagging is the tag set of an object, sent and returned by the ?tagging
+// subresource.
+type Tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	TagSet  TagSet   `xml:"TagSet"`
+}
+
+type TagSet struct {
+	Tags []Tag `xml:"Tag"`
+}
+
+type Tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+// AccessControlPolicy is the ACL of a bucket or object, sent and returned by
+// the ?acl subresource.
+type AccessControlPolicy struct {
+	XMLName           xml.Name          `xml:"AccessControlPolicy"`
+	Owner             *UserInfo         `xml:"Owner,omitempty"`
+	AccessControlList AccessControlList `xml:"AccessControlList"`
+}
+
+type AccessControlList struct {
+	Grants []Grant `xml:"Grant"`
+}
+
+type Grant struct {
+	Grantee    Grantee    `xml:"Grantee"`
+	Permission Permission `xml:"Permission"`
+}
+
+// Grantee is the receiver of a Grant. Its Type is carried in the xsi:type
+// attribute.
+type Grantee struct {
+	Type         GranteeType `xml:"-"`
+	ID           string      `xml:"ID,omitempty"`
+	DisplayName  string      `xml:"DisplayName,omitempty"`
+	EmailAddress string      `xml:"EmailAddress,omitempty"`
+	URI          string      `xml:"URI,omitempty"`
+}
+
+type granteeElements Grantee
+
+func (g Grantee) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = append(start.Attr,
+		xml.Attr{Name: xml.Name{Local: "xmlns:xsi"}, Value: "http://www.w3.org/2001/XMLSchema-instance"},
+		xml.Attr{Name: xml.Name{Local: "xsi:type"}, Value: string(g.Type)})
+	return e.EncodeElement(granteeElements(g), start)
+}
+
+func (g *Grantee) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := d.DecodeElement((*granteeElements)(g), &start); err != nil {
+		return err
+	}
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "type" {
+			g.Type = GranteeType(attr.Value)
+		}
+	}
+	return nil
+}
+
+type GranteeType string
+
+const (
+	GranteeCanonicalUser GranteeType = "CanonicalUser"
+	GranteeEmail         GranteeType = "AmazonCustomerByEmail"
+	GranteeGroup         GranteeType = "Group"
+)
+
+type Permission string
+
+const (
+	PermissionFullControl Permission = "FULL_CONTROL"
+	PermissionRead        Permission = "READ"
+	PermissionWrite       Permission = "WRITE"
+	PermissionReadACP     Permission = "READ_ACP"
+	PermissionWriteACP    Permission = "WRITE_ACP"
+)
+
+// MetadataDirective is the x-amz-metadata-directive of a copy: whether the
+// new object keeps the metadata of the source or takes it from the request.
+type MetadataDirective string
+
+const (
+	MetadataDirectiveCopy    MetadataDirective = "COPY"
+	MetadataDirectiveReplace MetadataDirective = "REPLACE"
+)
+
 type MFADeleteStatus string
 
 const (
@@ -290,6 +415,9 @@ const (
 func (v Version) GetVersionID() VersionID   { return v.VersionID }
 func (v *Version) setVersionID(i VersionID) { v.VersionID = i }
 
+func (d DeleteMarker) GetVersionID() VersionID   { return d.VersionID }
+func (d *DeleteMarker) setVersionID(i VersionID) { d.VersionID = i }
+
 type BucketInfo struct {
 	Name string `xml:"Name"`
 
@@ -306,3 +434,60 @@ type Storage struct {
 }
 
 type Buckets []BucketInfo
+
+// LifecycleConfiguration is the body of the bucket lifecycle subresource.
+// Only the AbortIncompleteMultipartUpload action is supported.
+type LifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration" json:"-"`
+	Rules   []LifecycleRule `xml:"Rule" json:"rules"`
+}
+
+type LifecycleRule struct {
+	ID     string          `xml:"ID,omitempty" json:"id,omitempty"`
+	Status LifecycleStatus `xml:"Status" json:"status"`
+
+	// Prefix is the deprecated form of Filter.Prefix.
+	Prefix string           `xml:"Prefix,omitempty" json:"prefix,omitempty"`
+	Filter *LifecycleFilter `xml:"Filter,omitempty" json:"filter,omitempty"`
+
+	AbortIncompleteMultipartUpload *AbortIncompleteMultipartUpload `xml:"AbortIncompleteMultipartUpload,omitempty" json:"abortIncompleteMultipartUpload,omitempty"`
+
+	// Unsupported collects the actions this gateway does not implement,
+	// such as Expiration and Transition.
+	Unsupported []lifecycleElement `xml:",any" json:"-"`
+}
+
+type LifecycleFilter struct {
+	Prefix string `xml:"Prefix" json:"prefix"`
+
+	Unsupported []lifecycleElement `xml:",any" json:"-"`
+}
+
+type AbortIncompleteMultipartUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation" json:"daysAfterInitiation"`
+}
+
+type lifecycleElement struct {
+	XMLName xml.Name
+}
+
+type LifecycleStatus string
+
+const (
+	LifecycleEnabled  LifecycleStatus = "Enabled"
+	LifecycleDisabled LifecycleStatus = "Disabled"
+)
+
+// KeyPrefix returns the key prefix the rule applies to.
+func (r *LifecycleRule) KeyPrefix() string {
+	if r.Filter != nil {
+		return r.Filter.Prefix
+	}
+	return r.Prefix
+}
+
+type CopyPartResult struct {
+	XMLName      xml.Name    `xml:"CopyPartResult"`
+	ETag         string      `xml:"ETag,omitempty"`
+	LastModified ContentTime `xml:"LastModified,omitempty"`
+}
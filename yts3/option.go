@@ -35,6 +35,38 @@ func WithHostBucket(enabled bool) Option {
 	return func(g *Yts3) { g.hostBucket = enabled }
 }
 
+// WithCredentialProvider enables AWS signature verification of every
+// request, using credentials to look up the secret of the signing access key.
+func WithCredentialProvider(credentials CredentialProvider) Option {
+	return func(g *Yts3) { g.credentials = credentials }
+}
+
+// WithAuthenticator replaces the Authenticator used to resolve the caller of
+// each request. It takes precedence over WithCredentialProvider.
+func WithAuthenticator(auth Authenticator) Option {
+	return func(g *Yts3) { g.auth = auth }
+}
+
+// WithUploadRegistry persists multipart uploads in registry, restoring the
+// uploads it already holds.
+func WithUploadRegistry(registry *UploadRegistry) Option {
+	return func(g *Yts3) { g.registry = registry }
+}
+
+// WithUploadReaper removes every interval the multipart uploads that are
+// older than maxAge or expired by a bucket's AbortIncompleteMultipartUpload
+// lifecycle rule, together with their cached parts. A maxAge of zero only
+// applies the lifecycle rules.
+func WithUploadReaper(maxAge, interval time.Duration) Option {
+	return func(g *Yts3) { g.reapMaxAge, g.reapInterval = maxAge, interval }
+}
+
+// WithMaxRanges limits the number of byte ranges a GET may request. Requests
+// for more fail with InvalidRange.
+func WithMaxRanges(n int) Option {
+	return func(g *Yts3) { g.maxRanges = n }
+}
+
 func WithoutVersioning() Option {
 	return func(g *Yts3) { g.versioned = nil }
 }
@@ -0,0 +1,522 @@
+package yts3
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MaxBucketPolicySize is the size limit S3 puts on a bucket policy: "Bucket
+// policies are limited to 20 KB in size."
+const MaxBucketPolicySize = 20 * 1024
+
+// PolicyDocument is a bucket policy, in the IAM policy language. Only the
+// parts of the language that apply to the objects of one bucket are
+// understood; see validatePolicy.
+type PolicyDocument struct {
+	Version   string           `json:"Version,omitempty"`
+	ID        string           `json:"Id,omitempty"`
+	Statement PolicyStatements `json:"Statement"`
+}
+
+type PolicyStatement struct {
+	Sid         string                             `json:"Sid,omitempty"`
+	Effect      PolicyEffect                       `json:"Effect"`
+	Principal   *PolicyPrincipal                   `json:"Principal,omitempty"`
+	Action      PolicyValues                       `json:"Action,omitempty"`
+	NotAction   PolicyValues                       `json:"NotAction,omitempty"`
+	Resource    PolicyValues                       `json:"Resource,omitempty"`
+	NotResource PolicyValues                       `json:"NotResource,omitempty"`
+	Condition   map[string]map[string]PolicyValues `json:"Condition,omitempty"`
+}
+
+type PolicyEffect string
+
+const (
+	PolicyAllow PolicyEffect = "Allow"
+	PolicyDeny  PolicyEffect = "Deny"
+)
+
+// PolicyStatements is the Statement of a policy, which may be written as a
+// single statement or as a list of them.
+type PolicyStatements []PolicyStatement
+
+func (s *PolicyStatements) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '{' {
+		var one PolicyStatement
+		if err := json.Unmarshal(data, &one); err != nil {
+			return err
+		}
+		*s = PolicyStatements{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]PolicyStatement)(s))
+}
+
+// PolicyValues is a policy element that may be written as a single string or
+// as a list of strings.
+type PolicyValues []string
+
+func (v *PolicyValues) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var one string
+		if err := json.Unmarshal(data, &one); err != nil {
+			return err
+		}
+		*v = PolicyValues{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(v))
+}
+
+// PolicyPrincipal is either "*", anyone, or {"AWS": [...]}, a list of
+// accounts. An account is given by its access key, its "YTA" public key, or
+// an IAM ARN of the account.
+type PolicyPrincipal struct {
+	Any bool
+	AWS PolicyValues
+}
+
+func (p *PolicyPrincipal) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if s != "*" {
+			return ErrorMessage(ErrMalformedPolicy, "Invalid principal in policy")
+		}
+		p.Any = true
+		return nil
+	}
+	var principals map[string]PolicyValues
+	if err := json.Unmarshal(data, &principals); err != nil {
+		return err
+	}
+	for k, v := range principals {
+		if k != "AWS" {
+			return ErrorMessagef(ErrMalformedPolicy, "Principal type %s is not supported", k)
+		}
+		p.AWS = v
+	}
+	return nil
+}
+
+func (p PolicyPrincipal) MarshalJSON() ([]byte, error) {
+	if p.Any {
+		return json.Marshal("*")
+	}
+	return json.Marshal(map[string]PolicyValues{"AWS": p.AWS})
+}
+
+// matches reports whether the principal includes the caller id.
+func (p *PolicyPrincipal) matches(id *Identity) bool {
+	if p.Any {
+		return true
+	}
+	for _, v := range p.AWS {
+		if v == "*" {
+			return true
+		}
+		if id == nil {
+			continue
+		}
+		if strings.HasPrefix(v, "arn:aws:iam::") {
+			// arn:aws:iam::<account>:root or :user/<name>
+			v = strings.SplitN(strings.TrimPrefix(v, "arn:aws:iam::"), ":", 2)[0]
+		}
+		if v == id.AccessKey || v == "YTA"+id.PublicKey {
+			return true
+		}
+	}
+	return false
+}
+
+// principalAccount returns the YottaChain account a principal names, as
+// "YTA" followed by its public key, or "" if it names none.
+func principalAccount(v string) string {
+	if strings.HasPrefix(v, "arn:aws:iam::") {
+		v = strings.SplitN(strings.TrimPrefix(v, "arn:aws:iam::"), ":", 2)[0]
+	}
+	if !strings.HasPrefix(v, "YTA") || len(v) == len("YTA") {
+		return ""
+	}
+	return v
+}
+
+// others returns the accounts other than owner that the principal names.
+func (p *PolicyPrincipal) others(owner *Identity) []string {
+	var accounts []string
+	for _, v := range p.AWS {
+		if (&PolicyPrincipal{AWS: PolicyValues{v}}).matches(owner) {
+			continue
+		}
+		if account := principalAccount(v); account != "" {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts
+}
+
+type policyDecision int
+
+const (
+	policyDefault policyDecision = iota
+	policyAllow
+	policyDeny
+)
+
+// policyRequest is what a policy is evaluated against: the action, the ARN
+// of the bucket or object it acts on, the caller and the values of the
+// condition keys, by lower case name.
+type policyRequest struct {
+	action     string
+	resource   string
+	identity   *Identity
+	conditions map[string]string
+}
+
+// evaluate applies the policy to req. A statement that denies the request
+// overrides any that allow it.
+func (p *PolicyDocument) evaluate(req *policyRequest) policyDecision {
+	decision := policyDefault
+	for i := range p.Statement {
+		s := &p.Statement[i]
+		if !s.matches(req) {
+			continue
+		}
+		if s.Effect == PolicyDeny {
+			return policyDeny
+		}
+		decision = policyAllow
+	}
+	return decision
+}
+
+func (s *PolicyStatement) matches(req *policyRequest) bool {
+	if s.Principal == nil || !s.Principal.matches(req.identity) {
+		return false
+	}
+	if len(s.Action) > 0 && !matchesAny(s.Action, req.action, true) {
+		return false
+	}
+	if len(s.NotAction) > 0 && matchesAny(s.NotAction, req.action, true) {
+		return false
+	}
+	if len(s.Resource) > 0 && !matchesAny(s.Resource, req.resource, false) {
+		return false
+	}
+	if len(s.NotResource) > 0 && matchesAny(s.NotResource, req.resource, false) {
+		return false
+	}
+	for op, keys := range s.Condition {
+		for key, values := range keys {
+			if !conditionMatches(op, key, values, req.conditions) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchesAny(patterns PolicyValues, s string, ignoreCase bool) bool {
+	if ignoreCase {
+		s = strings.ToLower(s)
+	}
+	for _, pattern := range patterns {
+		if ignoreCase {
+			pattern = strings.ToLower(pattern)
+		}
+		if wildcardMatch(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch matches s against a policy pattern, where "*" stands for any
+// run of characters and "?" for any single one.
+func wildcardMatch(pattern, s string) bool {
+	px, sx := 0, 0
+	starPx, starSx := -1, -1
+	for px < len(pattern) || sx < len(s) {
+		if px < len(pattern) {
+			switch c := pattern[px]; {
+			case c == '*':
+				starPx, starSx = px, sx+1
+				px++
+				continue
+			case sx < len(s) && (c == '?' || c == s[sx]):
+				px++
+				sx++
+				continue
+			}
+		}
+		if starPx >= 0 && starSx <= len(s) {
+			px, sx = starPx+1, starSx
+			starSx++
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// policyConditionKeys are the condition keys a policy may test, by lower
+// case name.
+var policyConditionKeys = map[string]bool{
+	"aws:sourceip":        true,
+	"aws:securetransport": true,
+	"s3:prefix":           true,
+}
+
+// policyConditionOperators maps the supported condition operators to
+// whether they are negated.
+var policyConditionOperators = map[string]bool{
+	"StringEquals":              false,
+	"StringNotEquals":           true,
+	"StringEqualsIgnoreCase":    false,
+	"StringNotEqualsIgnoreCase": true,
+	"StringLike":                false,
+	"StringNotLike":             true,
+	"IpAddress":                 false,
+	"NotIpAddress":              true,
+	"Bool":                      false,
+}
+
+// conditionMatches evaluates one condition key of a statement. A key that
+// the request does not have fails the condition, unless the operator is
+// negated or ends in IfExists.
+func conditionMatches(op, key string, values PolicyValues, conditions map[string]string) bool {
+	ifExists := strings.HasSuffix(op, "IfExists")
+	op = strings.TrimSuffix(op, "IfExists")
+	negated := policyConditionOperators[op]
+	value, ok := conditions[strings.ToLower(key)]
+	if !ok {
+		return ifExists || negated
+	}
+	matched := false
+	for _, v := range values {
+		switch op {
+		case "StringEquals", "StringNotEquals":
+			matched = v == value
+		case "StringEqualsIgnoreCase", "StringNotEqualsIgnoreCase":
+			matched = strings.EqualFold(v, value)
+		case "StringLike", "StringNotLike":
+			matched = wildcardMatch(v, value)
+		case "IpAddress", "NotIpAddress":
+			matched = ipMatches(v, value)
+		case "Bool":
+			matched = strings.EqualFold(v, value)
+		}
+		if matched {
+			break
+		}
+	}
+	return matched != negated
+}
+
+// ipMatches reports whether ip is in cidr, which may also be a single
+// address.
+func ipMatches(cidr, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	if !strings.Contains(cidr, "/") {
+		return addr.Equal(net.ParseIP(cidr))
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	return err == nil && network.Contains(addr)
+}
+
+// parsePolicy decodes a bucket policy and checks that it only uses what
+// evaluate understands, and only refers to bucket.
+func parsePolicy(bucket string, doc []byte) (*PolicyDocument, error) {
+	var policy PolicyDocument
+	if err := json.Unmarshal(doc, &policy); err != nil {
+		if HasErrorCode(err, ErrMalformedPolicy) {
+			return nil, err
+		}
+		return nil, ErrorMessage(ErrMalformedPolicy, "Policies must be valid JSON and the first byte must be '{'")
+	}
+	if err := validatePolicy(bucket, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// policyReadActions are the actions that can be allowed to other accounts,
+// by lower case name.
+var policyReadActions = map[string]bool{
+	"s3:getobject":        true,
+	"s3:getobjectversion": true,
+}
+
+// checkGrants checks the Allow statements that name accounts other than the
+// bucket owner, and reports whether there are any. Buckets are only reached
+// through the owner's own account, so those statements are served by
+// licensing the objects they cover to the accounts, as object ACLs are:
+// they can only allow reading objects, to accounts given by name.
+func (p *PolicyDocument) checkGrants(owner *Identity) (bool, error) {
+	var grants bool
+	for _, s := range p.Statement {
+		if s.Effect != PolicyAllow {
+			continue
+		}
+		if s.Principal.Any {
+			return false, ErrorMessage(ErrNotImplemented, "objects can only be licensed to given accounts, not to everyone")
+		}
+		others := false
+		for _, v := range s.Principal.AWS {
+			if v == "*" {
+				return false, ErrorMessage(ErrNotImplemented, "objects can only be licensed to given accounts, not to everyone")
+			}
+			if (&PolicyPrincipal{AWS: PolicyValues{v}}).matches(owner) {
+				continue
+			}
+			if principalAccount(v) == "" {
+				return false, ErrorMessage(ErrMalformedPolicy, "Invalid principal in policy")
+			}
+			others = true
+		}
+		if !others {
+			continue
+		}
+		if len(s.NotAction) > 0 || len(s.NotResource) > 0 || len(s.Condition) > 0 {
+			return false, ErrorMessage(ErrNotImplemented, "statements that allow other accounts cannot use NotAction, NotResource or Condition")
+		}
+		for _, action := range s.Action {
+			if !policyReadActions[strings.ToLower(action)] {
+				return false, ErrorMessagef(ErrNotImplemented, "other accounts can only be allowed s3:GetObject, not %s", action)
+			}
+		}
+		for _, resource := range s.Resource {
+			if !strings.Contains(resource, "/") {
+				return false, ErrorMessage(ErrMalformedPolicy, "Action does not apply to any resource(s) in statement")
+			}
+		}
+		grants = true
+	}
+	return grants, nil
+}
+
+// readers returns the accounts other than owner that the policy allows to
+// read object.
+func (p *PolicyDocument) readers(owner *Identity, bucket, object string) []string {
+	seen := make(map[string]bool)
+	var readers []string
+	for _, s := range p.Statement {
+		if s.Effect != PolicyAllow {
+			continue
+		}
+		for _, account := range s.Principal.others(owner) {
+			if seen[account] {
+				continue
+			}
+			seen[account] = true
+			id := &Identity{AccessKey: account, PublicKey: strings.TrimPrefix(account, "YTA")}
+			for action := range policyReadActions {
+				req := &policyRequest{
+					action:     action,
+					resource:   resourceARN(bucket, object),
+					identity:   id,
+					conditions: map[string]string{},
+				}
+				if p.evaluate(req) == policyAllow {
+					readers = append(readers, account)
+					break
+				}
+			}
+		}
+	}
+	return readers
+}
+
+func validatePolicy(bucket string, policy *PolicyDocument) error {
+	if policy.Version != "" && policy.Version != "2012-10-17" && policy.Version != "2008-10-17" {
+		return ErrorMessage(ErrMalformedPolicy, "Invalid policy document version")
+	}
+	if len(policy.Statement) == 0 {
+		return ErrorMessage(ErrMalformedPolicy, "Missing required field Statement")
+	}
+	for _, s := range policy.Statement {
+		if s.Effect != PolicyAllow && s.Effect != PolicyDeny {
+			return ErrorMessage(ErrMalformedPolicy, "Invalid effect")
+		}
+		if s.Principal == nil {
+			return ErrorMessage(ErrMalformedPolicy, "Missing required field Principal")
+		}
+		if (len(s.Action) == 0) == (len(s.NotAction) == 0) {
+			return ErrorMessage(ErrMalformedPolicy, "Missing required field Action")
+		}
+		for _, action := range append(s.Action, s.NotAction...) {
+			if action != "*" && !strings.HasPrefix(strings.ToLower(action), "s3:") {
+				return ErrorMessage(ErrMalformedPolicy, "Policy has invalid action")
+			}
+		}
+		if (len(s.Resource) == 0) == (len(s.NotResource) == 0) {
+			return ErrorMessage(ErrMalformedPolicy, "Missing required field Resource")
+		}
+		for _, resource := range append(s.Resource, s.NotResource...) {
+			if !strings.HasPrefix(resource, "arn:aws:s3:::") {
+				return ErrorMessage(ErrMalformedPolicy, "Policy has invalid resource")
+			}
+			name := strings.SplitN(strings.TrimPrefix(resource, "arn:aws:s3:::"), "/", 2)[0]
+			if !wildcardMatch(name, bucket) {
+				return ErrorMessage(ErrMalformedPolicy, "Policy has invalid resource")
+			}
+		}
+		for op, keys := range s.Condition {
+			if _, ok := policyConditionOperators[strings.TrimSuffix(op, "IfExists")]; !ok {
+				return ErrorMessagef(ErrMalformedPolicy, "Invalid Condition type : %s", op)
+			}
+			for key, values := range keys {
+				if !policyConditionKeys[strings.ToLower(key)] {
+					return ErrorMessagef(ErrMalformedPolicy, "Policy has an invalid condition key: %s", key)
+				}
+				for _, v := range values {
+					if err := validateConditionValue(op, v); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validateConditionValue(op, v string) error {
+	switch strings.TrimSuffix(op, "IfExists") {
+	case "IpAddress", "NotIpAddress":
+		if _, _, err := net.ParseCIDR(v); err != nil && net.ParseIP(v) == nil {
+			return ErrorMessagef(ErrMalformedPolicy, "Invalid IP address: %s", v)
+		}
+	case "Bool":
+		if _, err := strconv.ParseBool(v); err != nil {
+			return ErrorMessagef(ErrMalformedPolicy, "Invalid Bool value: %s", v)
+		}
+	}
+	return nil
+}
+
+// requestConditions returns the values of the condition keys for r.
+func requestConditions(r *http.Request) map[string]string {
+	conditions := map[string]string{
+		"aws:securetransport": strconv.FormatBool(r.TLS != nil),
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		conditions["aws:sourceip"] = host
+	}
+	if prefix, ok := r.URL.Query()["prefix"]; ok && len(prefix) > 0 {
+		conditions["s3:prefix"] = prefix[0]
+	}
+	return conditions
+}
+
+// resourceARN returns the ARN of a bucket, or of an object in it.
+func resourceARN(bucket, object string) string {
+	if object == "" {
+		return "arn:aws:s3:::" + bucket
+	}
+	return "arn:aws:s3:::" + bucket + "/" + object
+}
@@ -0,0 +1,226 @@
+package yts3
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestWildcardMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		expect     bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "ab", false},
+		{"ab", "abc", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"?", "", false},
+		{"a*", "a", true},
+		{"a*", "abc", true},
+		{"*c", "abc", true},
+		{"*c", "abd", false},
+		{"a*c", "ac", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abcd", false},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "aXcYb", false},
+		{"*a*a*", "banana", true},
+		{"**", "x", true},
+		{"*?", "", false},
+		{"*?", "x", true},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket/dir/file", true},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket", false},
+		{"arn:aws:s3:::bucket/dir/*.jpg", "arn:aws:s3:::bucket/dir/a/b.jpg", true},
+		{"arn:aws:s3:::bucket/dir/*.jpg", "arn:aws:s3:::bucket/dir/b.png", false},
+	} {
+		if out := wildcardMatch(tc.pattern, tc.s); out != tc.expect {
+			t.Errorf("wildcardMatch(%q, %q): expected %v, got %v", tc.pattern, tc.s, tc.expect, out)
+		}
+	}
+}
+
+var (
+	policyOwner = &Identity{AccessKey: "AKIDOWNER", PublicKey: "owner"}
+	policyOther = &Identity{AccessKey: "AKIDOTHER", PublicKey: "other"}
+)
+
+func mustParsePolicy(t *testing.T, doc string) *PolicyDocument {
+	t.Helper()
+	policy, err := parsePolicy("bucket", []byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	policy := mustParsePolicy(t, `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/public/*"},
+			{"Effect": "Deny", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::bucket/public/secret*"},
+			{"Effect": "Allow", "Principal": {"AWS": ["AKIDOTHER"]}, "Action": ["s3:GetObject", "s3:PutObject"], "Resource": "arn:aws:s3:::bucket/other/*"},
+			{"Effect": "Deny", "Principal": "*", "Action": "s3:DeleteObject", "Resource": "arn:aws:s3:::bucket/*",
+			 "Condition": {"NotIpAddress": {"aws:SourceIp": "192.0.2.0/24"}}},
+			{"Effect": "Allow", "Principal": "*", "NotAction": "s3:Delete*", "Resource": "arn:aws:s3:::bucket",
+			 "Condition": {"StringLike": {"s3:prefix": "public/*"}, "Bool": {"aws:SecureTransport": "true"}}}
+		]
+	}`)
+	for _, tc := range []struct {
+		name       string
+		action     string
+		object     string
+		identity   *Identity
+		conditions map[string]string
+		expect     policyDecision
+	}{
+		{"public read", "s3:GetObject", "public/a.txt", nil, nil, policyAllow},
+		{"action case", "S3:GETOBJECT", "public/a.txt", nil, nil, policyAllow},
+		{"public write", "s3:PutObject", "public/a.txt", nil, nil, policyDefault},
+		{"deny overrides allow", "s3:GetObject", "public/secret.txt", nil, nil, policyDeny},
+		{"other account", "s3:PutObject", "other/a.txt", policyOther, nil, policyAllow},
+		{"other account by public key", "s3:PutObject", "other/a.txt", &Identity{PublicKey: "other"}, nil, policyDefault},
+		{"anonymous is not the other account", "s3:PutObject", "other/a.txt", nil, nil, policyDefault},
+		{"other resource", "s3:PutObject", "private/a.txt", policyOther, nil, policyDefault},
+		{"delete from outside", "s3:DeleteObject", "a.txt", policyOwner, map[string]string{"aws:sourceip": "198.51.100.1"}, policyDeny},
+		{"delete from inside", "s3:DeleteObject", "a.txt", policyOwner, map[string]string{"aws:sourceip": "192.0.2.7"}, policyDefault},
+		{"delete without address", "s3:DeleteObject", "a.txt", policyOwner, map[string]string{}, policyDeny},
+		{"list prefix over tls", "s3:ListBucket", "", nil, map[string]string{"s3:prefix": "public/x", "aws:securetransport": "true"}, policyAllow},
+		{"list prefix in the clear", "s3:ListBucket", "", nil, map[string]string{"s3:prefix": "public/x", "aws:securetransport": "false"}, policyDefault},
+		{"list other prefix", "s3:ListBucket", "", nil, map[string]string{"s3:prefix": "private/", "aws:securetransport": "true"}, policyDefault},
+		{"list without prefix", "s3:ListBucket", "", nil, map[string]string{"aws:securetransport": "true"}, policyDefault},
+		{"not action", "s3:DeleteBucket", "", nil, map[string]string{"s3:prefix": "public/x", "aws:securetransport": "true"}, policyDefault},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conditions := tc.conditions
+			if conditions == nil {
+				conditions = map[string]string{}
+			}
+			req := &policyRequest{action: tc.action, resource: resourceARN("bucket", tc.object), identity: tc.identity, conditions: conditions}
+			if out := policy.evaluate(req); out != tc.expect {
+				t.Fatalf("expected %v, got %v", tc.expect, out)
+			}
+		})
+	}
+}
+
+func TestPolicyPrincipalMatches(t *testing.T) {
+	for _, tc := range []struct {
+		principal string
+		identity  *Identity
+		expect    bool
+	}{
+		{"*", nil, true},
+		{"AKIDOTHER", policyOther, true},
+		{"YTAother", policyOther, true},
+		{"arn:aws:iam::AKIDOTHER:root", policyOther, true},
+		{"arn:aws:iam::YTAother:user/name", policyOther, true},
+		{"AKIDOTHER", policyOwner, false},
+		{"AKIDOTHER", nil, false},
+		{"other", policyOther, false},
+	} {
+		p := &PolicyPrincipal{AWS: PolicyValues{tc.principal}}
+		if out := p.matches(tc.identity); out != tc.expect {
+			t.Errorf("%q matches %v: expected %v, got %v", tc.principal, tc.identity, tc.expect, out)
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		doc    string
+		expect ErrorCode
+	}{
+		{"single statement", `{"Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}}`, ErrNone},
+		{"resource wildcard", `{"Statement": [{"Effect": "Deny", "Principal": {"AWS": "*"}, "Action": "*", "Resource": "arn:aws:s3:::buck*"}]}`, ErrNone},
+		{"not json", `Statement`, ErrMalformedPolicy},
+		{"version", `{"Version": "2020-01-01", "Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}]}`, ErrMalformedPolicy},
+		{"no statement", `{"Version": "2012-10-17", "Statement": []}`, ErrMalformedPolicy},
+		{"effect", `{"Statement": [{"Effect": "Maybe", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}]}`, ErrMalformedPolicy},
+		{"no principal", `{"Statement": [{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}]}`, ErrMalformedPolicy},
+		{"principal string", `{"Statement": [{"Effect": "Allow", "Principal": "AKIDOTHER", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}]}`, ErrMalformedPolicy},
+		{"principal type", `{"Statement": [{"Effect": "Allow", "Principal": {"Service": "s3.amazonaws.com"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}]}`, ErrMalformedPolicy},
+		{"no action", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Resource": "arn:aws:s3:::bucket/*"}]}`, ErrMalformedPolicy},
+		{"action and not action", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "NotAction": "s3:PutObject", "Resource": "arn:aws:s3:::bucket/*"}]}`, ErrMalformedPolicy},
+		{"other service", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "iam:GetUser", "Resource": "arn:aws:s3:::bucket/*"}]}`, ErrMalformedPolicy},
+		{"no resource", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject"}]}`, ErrMalformedPolicy},
+		{"other bucket", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::other/*"}]}`, ErrMalformedPolicy},
+		{"not an s3 resource", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "bucket/*"}]}`, ErrMalformedPolicy},
+		{"condition operator", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*", "Condition": {"DateLessThan": {"aws:CurrentTime": "2030-01-01T00:00:00Z"}}}]}`, ErrMalformedPolicy},
+		{"condition key", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*", "Condition": {"StringEquals": {"aws:Referer": "x"}}}]}`, ErrMalformedPolicy},
+		{"condition address", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*", "Condition": {"IpAddress": {"aws:SourceIp": "192.0.2.0/33"}}}]}`, ErrMalformedPolicy},
+		{"condition bool", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*", "Condition": {"Bool": {"aws:SecureTransport": "yes"}}}]}`, ErrMalformedPolicy},
+		{"if exists", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*", "Condition": {"IpAddressIfExists": {"aws:SourceIp": "192.0.2.1"}}}]}`, ErrNone},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parsePolicy("bucket", []byte(tc.doc))
+			if !HasErrorCode(err, tc.expect) {
+				t.Fatalf("expected %q, got %v", tc.expect, err)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckGrants(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		statement string
+		grants    bool
+		expect    ErrorCode
+	}{
+		{"owner only", `{"Effect": "Allow", "Principal": {"AWS": "AKIDOWNER"}, "Action": "s3:*", "Resource": "arn:aws:s3:::bucket/*"}`, false, ErrNone},
+		{"deny everyone", `{"Effect": "Deny", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::bucket/*"}`, false, ErrNone},
+		{"read", `{"Effect": "Allow", "Principal": {"AWS": "YTAother"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}`, true, ErrNone},
+		{"read by arn", `{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::YTAother:root"}, "Action": ["s3:GetObject", "s3:GetObjectVersion"], "Resource": "arn:aws:s3:::bucket/dir/*"}`, true, ErrNone},
+		{"everyone", `{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}`, false, ErrNotImplemented},
+		{"everyone in list", `{"Effect": "Allow", "Principal": {"AWS": ["YTAother", "*"]}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}`, false, ErrNotImplemented},
+		{"access key", `{"Effect": "Allow", "Principal": {"AWS": "AKIDOTHER"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}`, false, ErrMalformedPolicy},
+		{"write", `{"Effect": "Allow", "Principal": {"AWS": "YTAother"}, "Action": "s3:PutObject", "Resource": "arn:aws:s3:::bucket/*"}`, false, ErrNotImplemented},
+		{"bucket", `{"Effect": "Allow", "Principal": {"AWS": "YTAother"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket"}`, false, ErrMalformedPolicy},
+		{"condition", `{"Effect": "Allow", "Principal": {"AWS": "YTAother"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*", "Condition": {"Bool": {"aws:SecureTransport": "true"}}}`, false, ErrNotImplemented},
+		{"not resource", `{"Effect": "Allow", "Principal": {"AWS": "YTAother"}, "Action": "s3:GetObject", "NotResource": "arn:aws:s3:::bucket/private/*"}`, false, ErrNotImplemented},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := mustParsePolicy(t, `{"Statement": [`+tc.statement+`]}`)
+			grants, err := policy.checkGrants(policyOwner)
+			if !HasErrorCode(err, tc.expect) {
+				t.Fatalf("expected %q, got %v", tc.expect, err)
+			}
+			if grants != tc.grants {
+				t.Fatalf("expected grants %v, got %v", tc.grants, grants)
+			}
+		})
+	}
+}
+
+func TestPolicyReaders(t *testing.T) {
+	policy := mustParsePolicy(t, `{
+		"Statement": [
+			{"Effect": "Allow", "Principal": {"AWS": ["YTAalice", "YTAbob", "AKIDOWNER"]}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/shared/*"},
+			{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::YTAcarol:root"}, "Action": "s3:GetObjectVersion", "Resource": "arn:aws:s3:::bucket/*"},
+			{"Effect": "Deny", "Principal": {"AWS": "YTAbob"}, "Action": "s3:*", "Resource": "arn:aws:s3:::bucket/shared/private/*"}
+		]
+	}`)
+	for _, tc := range []struct {
+		object string
+		expect []string
+	}{
+		{"shared/a.txt", []string{"YTAalice", "YTAbob", "YTAcarol"}},
+		{"shared/private/a.txt", []string{"YTAalice", "YTAcarol"}},
+		{"other/a.txt", []string{"YTAcarol"}},
+	} {
+		readers := policy.readers(policyOwner, "bucket", tc.object)
+		sort.Strings(readers)
+		if !reflect.DeepEqual(readers, tc.expect) {
+			t.Errorf("readers of %s: expected %v, got %v", tc.object, tc.expect, readers)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package yts3
+
+import (
+	"crypto/hmac"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+
+	// From the docs: "The minimum value you can set is 1, and the maximum is
+	// 604800 (seven days)."
+	MaxPresignedExpires = 7 * 24 * 60 * 60
+)
+
+// isPresignedRequest reports whether the request authenticates with query
+// string parameters instead of the Authorization header.
+func isPresignedRequest(query url.Values) bool {
+	_, ok := query["X-Amz-Signature"]
+	return ok || isPresignedV2(query)
+}
+
+// presignedObjectRequest reports whether a presigned request targets a plain
+// object operation, the only operations presigned URLs are accepted for.
+func presignedObjectRequest(object string, query url.Values) bool {
+	if object == "" {
+		return false
+	}
+	for _, sub := range []string{"uploadId", "uploads", "versioning", "versions"} {
+		if _, ok := query[sub]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyPresignedV4 checks a SigV4 presigned URL and returns the
+// credential that signed it. now is used to check X-Amz-Date/X-Amz-Expires.
+func verifyPresignedV4(rq *http.Request, credentials CredentialProvider, now time.Time) (*Credential, error) {
+	switch rq.Method {
+	case http.MethodGet, http.MethodPut, http.MethodHead, http.MethodDelete:
+	default:
+		return nil, ErrorMessagef(ErrAccessDenied, "presigned URLs are not supported for %s", rq.Method)
+	}
+	query := rq.URL.Query()
+	if query.Get("X-Amz-Algorithm") != signV4Algorithm {
+		return nil, ErrorMessage(ErrAuthorizationQueryParametersError, "X-Amz-Algorithm only supports \"AWS4-HMAC-SHA256\"")
+	}
+	scope, err := parseCredential(query.Get("X-Amz-Credential"))
+	if err != nil {
+		return nil, ErrorMessage(ErrAuthorizationQueryParametersError, err.Error())
+	}
+	amzDate := query.Get("X-Amz-Date")
+	signedAt, err := time.Parse(iso8601Format, amzDate)
+	if err != nil {
+		return nil, ErrorMessage(ErrAuthorizationQueryParametersError, "X-Amz-Date must be in the ISO8601 Long Format \"yyyyMMdd'T'HHmmss'Z'\"")
+	}
+	if !strings.HasPrefix(amzDate, scope.date) {
+		return nil, ErrorMessage(ErrAuthorizationQueryParametersError, "credential date does not match X-Amz-Date")
+	}
+	expires, err := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
+	if err != nil || expires < 1 {
+		return nil, ErrorMessage(ErrAuthorizationQueryParametersError, "X-Amz-Expires should be a number greater than 0")
+	}
+	if expires > MaxPresignedExpires {
+		return nil, ErrorMessage(ErrAuthorizationQueryParametersError, "X-Amz-Expires must be less than a week (in seconds) that is; 604800")
+	}
+	if now.Before(signedAt) {
+		return nil, ErrorMessage(ErrAccessDenied, "Request is not valid yet")
+	}
+	if now.After(signedAt.Add(time.Duration(expires) * time.Second)) {
+		return nil, ErrorMessage(ErrAccessDenied, "Request has expired")
+	}
+	signedHeaders := strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+	signature := query.Get("X-Amz-Signature")
+	if signature == "" || len(signedHeaders) == 0 || signedHeaders[0] == "" {
+		return nil, ErrorMessage(ErrAuthorizationQueryParametersError, "query-string authentication requires the X-Amz-Signature and X-Amz-SignedHeaders parameters")
+	}
+	payloadHash := query.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = unsignedPayload
+	}
+	cred, err := credentials.Credential(scope.accessKey)
+	if err != nil {
+		return nil, err
+	}
+	query.Del("X-Amz-Signature")
+	canonical := canonicalRequestV4(rq, query, signedHeaders, payloadHash)
+	expected := signV4(cred.SecretKey, scope, amzDate, canonical)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		logrus.Warnf("[Auth]presigned signature mismatch for %s,canonical request:\n%s\n", scope.accessKey, canonical)
+		return nil, ResourceError(ErrSignatureDoesNotMatch, rq.URL.Path)
+	}
+	return cred, nil
+}
@@ -48,8 +48,12 @@ func (o *ObjectRangeRequest) Range(size int64) (*ObjectRange, error) {
 	} else {
 		// If no start is specified, end specifies the range start relative
 		// to the end of the file.
+		// A suffix longer than the file selects all of it.
 		end := o.End
 		start = size - end
+		if start < 0 && end > 0 {
+			start = 0
+		}
 		length = size - start
 	}
 
@@ -64,11 +68,23 @@ func (o *ObjectRangeRequest) Range(size int64) (*ObjectRange, error) {
 	return &ObjectRange{Start: start, Length: length}, nil
 }
 
-// parseRangeHeader parses a single byte range from the Range header.
-//
-// Amazon S3 doesn't support retrieving multiple ranges of data per GET request:
-// https://docs.aws.amazon.com/AmazonS3/latest/API/RESTObjectGET.html
+// parseRangeHeader parses a single byte range from the Range header. Headers
+// with several ranges are rejected; see parseRangesHeader.
 func parseRangeHeader(s string) (*ObjectRangeRequest, error) {
+	rnges, err := parseRangesHeader(s)
+	if err != nil || rnges == nil {
+		return nil, err
+	}
+	if len(rnges) > 1 {
+		return nil, ErrInvalidRange
+	}
+	return rnges[0], nil
+}
+
+// parseRangesHeader parses the comma separated byte ranges of a Range header.
+// Amazon S3 only serves the first range, but video players and PDF viewers
+// rely on multipart/byteranges responses for several.
+func parseRangesHeader(s string) ([]*ObjectRangeRequest, error) {
 	if s == "" {
 		return nil, nil
 	}
@@ -78,24 +94,27 @@ func parseRangeHeader(s string) (*ObjectRangeRequest, error) {
 		return nil, ErrInvalidRange
 	}
 
-	ranges := strings.Split(s[len(b):], "-")
-	// if len(ranges) > 1 {
-	// 	return nil, ErrorMessage(ErrNotImplemented, "multiple ranges not supported")
-	// }
-
-	rnge := strings.TrimSpace(ranges[0])
-	if len(rnge) == 0 {
-		return nil, ErrInvalidRange
+	var rnges []*ObjectRangeRequest
+	for _, spec := range strings.Split(s[len(b):], ",") {
+		o, err := parseByteRange(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, err
+		}
+		rnges = append(rnges, o)
 	}
+	return rnges, nil
+}
 
-	i := strings.Index(s, "-")
+// parseByteRange parses one "first-last", "first-" or "-suffix" range.
+func parseByteRange(spec string) (*ObjectRangeRequest, error) {
+	i := strings.Index(spec, "-")
 	if i < 0 {
 		return nil, ErrInvalidRange
 	}
 
 	var o ObjectRangeRequest
 
-	start, end := strings.TrimSpace(ranges[0]), strings.TrimSpace(ranges[1])
+	start, end := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
 	if start == "" {
 		o.FromEnd = true
 
@@ -0,0 +1,197 @@
+package yts3
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRangesHeader(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		expect []*ObjectRangeRequest
+		err    error
+	}{
+		{"", nil, nil},
+		{"bytes=0-9", []*ObjectRangeRequest{{Start: 0, End: 9}}, nil},
+		{"bytes=5-", []*ObjectRangeRequest{{Start: 5, End: RangeNoEnd}}, nil},
+		{"bytes=-5", []*ObjectRangeRequest{{End: 5, FromEnd: true}}, nil},
+		{"bytes=3-3", []*ObjectRangeRequest{{Start: 3, End: 3}}, nil},
+		{"bytes=0-0,-1", []*ObjectRangeRequest{{Start: 0, End: 0}, {End: 1, FromEnd: true}}, nil},
+		{"bytes=0-9, 20-29 ,40-", []*ObjectRangeRequest{{Start: 0, End: 9}, {Start: 20, End: 29}, {Start: 40, End: RangeNoEnd}}, nil},
+		{"bytes= 1 - 2", []*ObjectRangeRequest{{Start: 1, End: 2}}, nil},
+		{"bytes=0-9,0-9", []*ObjectRangeRequest{{Start: 0, End: 9}, {Start: 0, End: 9}}, nil},
+		{"0-9", nil, ErrInvalidRange},
+		{"items=0-9", nil, ErrInvalidRange},
+		{"bytes=", nil, ErrInvalidRange},
+		{"bytes=9", nil, ErrInvalidRange},
+		{"bytes=9-0", nil, ErrInvalidRange},
+		{"bytes=a-9", nil, ErrInvalidRange},
+		{"bytes=0-b", nil, ErrInvalidRange},
+		{"bytes=-", nil, ErrInvalidRange},
+		{"bytes=0-9,", nil, ErrInvalidRange},
+		{"bytes=0-9,x", nil, ErrInvalidRange},
+	} {
+		out, err := parseRangesHeader(tc.header)
+		if err != tc.err {
+			t.Errorf("parseRangesHeader(%q): expected error %v, got %v", tc.header, tc.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, tc.expect) {
+			t.Errorf("parseRangesHeader(%q): expected %+v, got %+v", tc.header, tc.expect, out)
+		}
+	}
+}
+
+func TestParseRangeHeader(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		expect *ObjectRangeRequest
+		err    error
+	}{
+		{"", nil, nil},
+		{"bytes=0-9", &ObjectRangeRequest{Start: 0, End: 9}, nil},
+		{"bytes=0-9,20-29", nil, ErrInvalidRange},
+		{"bytes=9-0", nil, ErrInvalidRange},
+	} {
+		out, err := parseRangeHeader(tc.header)
+		if err != tc.err {
+			t.Errorf("parseRangeHeader(%q): expected error %v, got %v", tc.header, tc.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, tc.expect) {
+			t.Errorf("parseRangeHeader(%q): expected %+v, got %+v", tc.header, tc.expect, out)
+		}
+	}
+}
+
+func TestObjectRangeRequestRange(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		size   int64
+		expect *ObjectRange
+		err    error
+	}{
+		{"bytes=0-9", 100, &ObjectRange{Start: 0, Length: 10}, nil},
+		{"bytes=90-99", 100, &ObjectRange{Start: 90, Length: 10}, nil},
+		{"bytes=90-199", 100, &ObjectRange{Start: 90, Length: 10}, nil},
+		{"bytes=99-", 100, &ObjectRange{Start: 99, Length: 1}, nil},
+		{"bytes=0-", 100, &ObjectRange{Start: 0, Length: 100}, nil},
+		{"bytes=100-", 100, nil, ErrInvalidRange},
+		{"bytes=100-199", 100, nil, ErrInvalidRange},
+		{"bytes=-10", 100, &ObjectRange{Start: 90, Length: 10}, nil},
+		{"bytes=-100", 100, &ObjectRange{Start: 0, Length: 100}, nil},
+		{"bytes=-500", 100, &ObjectRange{Start: 0, Length: 100}, nil},
+		{"bytes=-0", 100, nil, ErrInvalidRange},
+		{"bytes=0-0", 0, nil, ErrInvalidRange},
+		{"bytes=-1", 0, nil, ErrInvalidRange},
+	} {
+		rnge, err := parseRangeHeader(tc.header)
+		if err != nil {
+			t.Fatalf("parseRangeHeader(%q): %v", tc.header, err)
+		}
+		out, err := rnge.Range(tc.size)
+		if err != tc.err {
+			t.Errorf("%q of %d bytes: expected error %v, got %v", tc.header, tc.size, tc.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, tc.expect) {
+			t.Errorf("%q of %d bytes: expected %+v, got %+v", tc.header, tc.size, tc.expect, out)
+		}
+	}
+
+	if out, err := (*ObjectRangeRequest)(nil).Range(100); out != nil || err != nil {
+		t.Errorf("nil range: expected nil, got %+v, %v", out, err)
+	}
+}
+
+// rangeContents is object contents that can be read at any range.
+type rangeContents struct {
+	io.ReadCloser
+	data string
+}
+
+func (c *rangeContents) ReadRange(start, length int64) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(c.data[start : start+length])), nil
+}
+
+func TestWriteMultiRangeResponse(t *testing.T) {
+	const data = "0123456789abcdefghij"
+	type part struct {
+		contentRange, body string
+	}
+	for _, tc := range []struct {
+		name   string
+		header string
+		expect []part
+		err    error
+	}{
+		{"two", "bytes=0-1,-2", []part{{"bytes 0-1/20", "01"}, {"bytes 18-19/20", "ij"}}, nil},
+		{"overlapping", "bytes=0-4,2-6", []part{{"bytes 0-4/20", "01234"}, {"bytes 2-6/20", "23456"}}, nil},
+		{"clipped", "bytes=15-,18-100", []part{{"bytes 15-19/20", "fghij"}, {"bytes 18-19/20", "ij"}}, nil},
+		{"unsatisfiable left out", "bytes=30-40,5-5", []part{{"bytes 5-5/20", "5"}}, nil},
+		{"none satisfiable", "bytes=30-40,20-", nil, ErrInvalidRange},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rnges, err := parseRangesHeader(tc.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			obj := &Object{
+				Name:     "object",
+				Metadata: map[string]string{"Content-Type": "text/plain"},
+				Size:     int64(len(data)),
+				Contents: &rangeContents{ioutil.NopCloser(strings.NewReader(data)), data},
+			}
+			w := httptest.NewRecorder()
+			done, err := (&Yts3{}).writeMultiRangeResponse(obj, rnges, w)
+			if !done {
+				t.Fatal("expected the response to be written")
+			}
+			if err != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if w.Code != http.StatusPartialContent {
+				t.Fatalf("expected status %d, got %d", http.StatusPartialContent, w.Code)
+			}
+			mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+			if err != nil || mediaType != "multipart/byteranges" {
+				t.Fatalf("expected multipart/byteranges, got %q", w.Header().Get("Content-Type"))
+			}
+			mr := multipart.NewReader(w.Body, params["boundary"])
+			var parts []part
+			for {
+				p, err := mr.NextPart()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				if ct := p.Header.Get("Content-Type"); ct != "text/plain" {
+					t.Fatalf("expected part type text/plain, got %q", ct)
+				}
+				body, _ := ioutil.ReadAll(p)
+				parts = append(parts, part{p.Header.Get("Content-Range"), string(body)})
+			}
+			if !reflect.DeepEqual(parts, tc.expect) {
+				t.Fatalf("expected %v, got %v", tc.expect, parts)
+			}
+		})
+	}
+
+	// Without a RangeReader the ranges are not served.
+	obj := &Object{Size: int64(len(data)), Contents: ioutil.NopCloser(strings.NewReader(data))}
+	rnges, _ := parseRangesHeader("bytes=0-1,3-4")
+	if done, err := (&Yts3{}).writeMultiRangeResponse(obj, rnges, httptest.NewRecorder()); done || err != nil {
+		t.Fatalf("expected nothing written, got %v, %v", done, err)
+	}
+}
@@ -0,0 +1,310 @@
+package yts3
+
+import (
+	"encoding/xml"
+	"expvar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	reapedUploads  = expvar.NewInt("yts3.multipart.reaped_uploads")
+	reclaimedBytes = expvar.NewInt("yts3.multipart.reclaimed_bytes")
+)
+
+// Lifecycle returns the lifecycle configuration of bucket.
+func (u *uploader) Lifecycle(owner, bucket string) (*LifecycleConfiguration, error) {
+	if u.configs != nil {
+		doc, err := u.configs.BucketConfig(owner, bucket, BucketConfigLifecycle)
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			config := &LifecycleConfiguration{}
+			if err := xml.Unmarshal(doc, config); err != nil {
+				logrus.Errorf("[Lifecycle]%s stored lifecycle err:%s\n", bucket, err)
+				return nil, err
+			}
+			return config, nil
+		}
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	config, ok := u.lifecycles[ownerBucket(owner, bucket)]
+	if !ok {
+		return nil, ResourceError(ErrNoSuchLifecycleConfiguration, bucket)
+	}
+	return config, nil
+}
+
+func (u *uploader) SetLifecycle(owner, bucket string, config *LifecycleConfiguration) error {
+	if u.configs != nil {
+		doc, err := xml.Marshal(config)
+		if err != nil {
+			return err
+		}
+		if err := u.configs.SetBucketConfig(owner, bucket, BucketConfigLifecycle, doc); err != nil {
+			return err
+		}
+		// The rules kept by the gateway before are replaced.
+		return u.deleteLocalLifecycle(owner, bucket)
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	key := ownerBucket(owner, bucket)
+	if u.registry != nil {
+		if err := u.registry.saveLifecycle(key, config); err != nil {
+			logrus.Errorf("[Lifecycle]Registry save %s err:%s\n", bucket, err)
+			return err
+		}
+	}
+	u.lifecycles[key] = config
+	return nil
+}
+
+func (u *uploader) DeleteLifecycle(owner, bucket string) error {
+	if u.configs != nil {
+		if err := u.configs.SetBucketConfig(owner, bucket, BucketConfigLifecycle, nil); err != nil {
+			return err
+		}
+	}
+	return u.deleteLocalLifecycle(owner, bucket)
+}
+
+// deleteLocalLifecycle removes the lifecycle rules of bucket kept by the
+// gateway.
+func (u *uploader) deleteLocalLifecycle(owner, bucket string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	key := ownerBucket(owner, bucket)
+	if _, ok := u.lifecycles[key]; !ok {
+		return nil
+	}
+	if u.registry != nil {
+		if err := u.registry.deleteLifecycle(key); err != nil {
+			logrus.Errorf("[Lifecycle]Registry delete %s err:%s\n", bucket, err)
+			return err
+		}
+	}
+	delete(u.lifecycles, key)
+	return nil
+}
+
+// expired reports whether mpu has outlived maxAge or an enabled
+// AbortIncompleteMultipartUpload rule of config, which may be nil. A maxAge
+// of zero only applies the lifecycle rules.
+func expired(mpu *multipartUpload, config *LifecycleConfiguration, now time.Time, maxAge time.Duration) bool {
+	age := now.Sub(mpu.Initiated)
+	if maxAge > 0 && age > maxAge {
+		return true
+	}
+	if config == nil {
+		return false
+	}
+	for _, rule := range config.Rules {
+		if rule.Status != LifecycleEnabled || rule.AbortIncompleteMultipartUpload == nil {
+			continue
+		}
+		if !strings.HasPrefix(mpu.Object, rule.KeyPrefix()) {
+			continue
+		}
+		if age > time.Duration(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation)*24*time.Hour {
+			return true
+		}
+	}
+	return false
+}
+
+// Reap removes the expired uploads and deletes their cached parts. It
+// returns the number of uploads removed and the bytes reclaimed.
+func (u *uploader) Reap(now time.Time, maxAge time.Duration) (uploads int, reclaimed int64) {
+	var candidates []*multipartUpload
+	u.mu.Lock()
+	for _, bucketUps := range u.buckets {
+		for _, mpu := range bucketUps.uploads {
+			candidates = append(candidates, mpu)
+		}
+	}
+	u.mu.Unlock()
+
+	// The rules may be kept by the Backend, so they are read without holding
+	// the uploader, once per bucket.
+	configs := make(map[string]*LifecycleConfiguration)
+	var expiredUploads []*multipartUpload
+	for _, mpu := range candidates {
+		key := ownerBucket(mpu.Owner, mpu.Bucket)
+		config, ok := configs[key]
+		if !ok {
+			var err error
+			config, err = u.Lifecycle(mpu.Owner, mpu.Bucket)
+			if err != nil && !HasErrorCode(err, ErrNoSuchLifecycleConfiguration) {
+				logrus.Warnf("[Lifecycle]%s lifecycle err:%s\n", mpu.Bucket, err)
+			}
+			configs[key] = config
+		}
+		if expired(mpu, config, now, maxAge) {
+			expiredUploads = append(expiredUploads, mpu)
+		}
+	}
+
+	var removed []*multipartUpload
+	u.mu.Lock()
+	for _, mpu := range expiredUploads {
+		// Skip the uploads that were completed, aborted or started being
+		// completed meanwhile.
+		if cur, err := u.getUnlocked(mpu.Owner, mpu.Bucket, mpu.Object, mpu.ID); err != nil || cur != mpu || !mpu.setState(uploadOpen, uploadDiscarded) {
+			continue
+		}
+		u.removeUnlocked(mpu)
+		removed = append(removed, mpu)
+	}
+	u.mu.Unlock()
+
+	for _, mpu := range removed {
+		size := mpu.cachedSize()
+		if err := mpu.discard(); err != nil {
+			continue
+		}
+		logrus.Infof("[MultipartUpload]Reaped %s /%s/%s,initiated %s,%d bytes\n", mpu.ID, mpu.Bucket, mpu.Object, mpu.Initiated.Format(time.RFC3339), size)
+		uploads++
+		reclaimed += size
+	}
+	reapedUploads.Add(int64(uploads))
+	reclaimedBytes.Add(reclaimed)
+	return uploads, reclaimed
+}
+
+// reapLoop calls Reap every interval until the process exits.
+func (u *uploader) reapLoop(timeSource TimeSource, maxAge, interval time.Duration) {
+	logrus.Infof("[MultipartUpload]Reaper started,max age %s,interval %s\n", maxAge, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if uploads, reclaimed := u.Reap(timeSource.Now(), maxAge); uploads > 0 {
+			logrus.Infof("[MultipartUpload]Reaper removed %d uploads,reclaimed %d bytes\n", uploads, reclaimed)
+		}
+		if dirs, reclaimed := reapLegacyParts(s3Cache(), timeSource.Now(), maxAge); dirs > 0 {
+			logrus.Infof("[MultipartUpload]Reaper removed %d legacy part directories,reclaimed %d bytes\n", dirs, reclaimed)
+		}
+	}
+}
+
+// reapLegacyParts removes the part directories that were kept under
+// S3Cache/<bucket>/<object> before every upload had its own directory, once
+// nothing in them has changed for maxAge. Those uploads are not in the
+// registry, so their age is the only thing to go by; a maxAge of zero keeps
+// them. Only the directories under a bucket named directory that hold
+// nothing but part files are removed, with the directories they leave
+// empty, so that nothing else kept in the cache directory is touched. It
+// returns the number of directories removed and the bytes reclaimed.
+func reapLegacyParts(cacheDir string, now time.Time, maxAge time.Duration) (dirs int, reclaimed int64) {
+	if maxAge <= 0 {
+		return 0, 0
+	}
+	buckets, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		return 0, 0
+	}
+	for _, bucket := range buckets {
+		if !bucket.IsDir() || ValidateBucketName(bucket.Name()) != nil {
+			continue
+		}
+		n, size := reapLegacyPartDirs(filepath.Join(cacheDir, bucket.Name()), now, maxAge)
+		dirs += n
+		reclaimed += size
+	}
+	reclaimedBytes.Add(reclaimed)
+	return dirs, reclaimed
+}
+
+// reapLegacyPartDirs removes the expired part directories under dir, which
+// is removed too if that leaves it empty.
+func reapLegacyPartDirs(dir string, now time.Time, maxAge time.Duration) (dirs int, reclaimed int64) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, 0
+	}
+	if isLegacyPartDir(entries) {
+		size, modified := treeStat(dir)
+		if now.Sub(modified) <= maxAge {
+			return 0, 0
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			logrus.Errorf("[MultipartUpload]Remove legacy parts %s err:%s\n", dir, err)
+			return 0, 0
+		}
+		logrus.Infof("[MultipartUpload]Reaped legacy parts %s,modified %s,%d bytes\n", dir, modified.Format(time.RFC3339), size)
+		return 1, size
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		n, size := reapLegacyPartDirs(filepath.Join(dir, entry.Name()), now, maxAge)
+		dirs += n
+		reclaimed += size
+	}
+	if dirs > 0 {
+		if rest, err := ioutil.ReadDir(dir); err == nil && len(rest) == 0 {
+			os.Remove(dir)
+		}
+	}
+	return dirs, reclaimed
+}
+
+// isLegacyPartDir reports whether entries are those of a legacy part
+// directory: files named after their part number, and nothing else.
+func isLegacyPartDir(entries []os.FileInfo) bool {
+	if len(entries) == 0 {
+		return false
+	}
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() {
+			return false
+		}
+		n, err := strconv.Atoi(entry.Name())
+		if err != nil || n < 1 || n > MaxUploadPartNumber || strconv.Itoa(n) != entry.Name() {
+			return false
+		}
+	}
+	return true
+}
+
+// treeStat returns the size of the files under path and the time the most
+// recently modified of them, or path itself, was changed.
+func treeStat(path string) (size int64, modified time.Time) {
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, modified
+}
+
+// cachedSize returns the size of the parts of mpu in the S3 cache.
+func (mpu *multipartUpload) cachedSize() int64 {
+	files, err := ioutil.ReadDir(mpu.partDir())
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, f := range files {
+		if !f.IsDir() {
+			size += f.Size()
+		}
+	}
+	return size
+}
@@ -0,0 +1,179 @@
+package yts3
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	uploadsBucket   = []byte("uploads")
+	lifecycleBucket = []byte("lifecycle")
+)
+
+// UploadRegistry persists the state of in-flight multipart uploads, so that
+// they survive a restart of the gateway. The part bodies themselves stay in
+// the S3 cache directory; the registry only records which parts exist. The
+// bucket lifecycle rules that expire uploads are kept alongside them.
+type UploadRegistry struct {
+	db *bolt.DB
+}
+
+// uploadRecord is the persisted form of a multipartUpload.
+type uploadRecord struct {
+	ID        UploadID               `json:"id"`
+	Owner     string                 `json:"owner,omitempty"`
+	Bucket    string                 `json:"bucket"`
+	Object    string                 `json:"object"`
+	Meta      map[string]string      `json:"meta"`
+	Initiated time.Time              `json:"initiated"`
+	Parts     []*multipartUploadPart `json:"parts"`
+}
+
+// OpenUploadRegistry opens (or creates) the registry file at path.
+func OpenUploadRegistry(path string) (*UploadRegistry, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(uploadsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(lifecycleBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &UploadRegistry{db: db}, nil
+}
+
+func (r *UploadRegistry) Close() error {
+	return r.db.Close()
+}
+
+// save writes the current state of mpu. The caller must hold mpu.mu or
+// otherwise own mpu exclusively.
+func (r *UploadRegistry) save(mpu *multipartUpload) error {
+	rec := uploadRecord{
+		ID:        mpu.ID,
+		Owner:     mpu.Owner,
+		Bucket:    mpu.Bucket,
+		Object:    mpu.Object,
+		Meta:      mpu.Meta,
+		Initiated: mpu.Initiated,
+	}
+	for _, part := range mpu.parts {
+		if part != nil {
+			rec.Parts = append(rec.Parts, part)
+		}
+	}
+	data, err := json.Marshal(&rec)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(uploadsBucket).Put([]byte(mpu.ID), data)
+	})
+}
+
+func (r *UploadRegistry) delete(id UploadID) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(uploadsBucket).Delete([]byte(id))
+	})
+}
+
+// load returns every upload in the registry. Records that cannot be decoded
+// are logged and skipped.
+func (r *UploadRegistry) load() ([]*multipartUpload, error) {
+	var uploads []*multipartUpload
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(uploadsBucket).ForEach(func(k, v []byte) error {
+			var rec uploadRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				logrus.Errorf("[MultipartUpload]Registry record %s err:%s\n", k, err)
+				return nil
+			}
+			mpu := &multipartUpload{
+				ID:        rec.ID,
+				Owner:     rec.Owner,
+				Bucket:    rec.Bucket,
+				Object:    rec.Object,
+				Meta:      rec.Meta,
+				Initiated: rec.Initiated,
+			}
+			for _, part := range rec.Parts {
+				if part == nil || part.PartNumber <= 0 || part.PartNumber > MaxUploadPartNumber {
+					continue
+				}
+				if part.MD5 == nil {
+					upgradePart(mpu, part)
+				}
+				if part.PartNumber >= len(mpu.parts) {
+					mpu.parts = append(mpu.parts, make([]*multipartUploadPart, part.PartNumber-len(mpu.parts)+1)...)
+				}
+				mpu.parts[part.PartNumber] = part
+			}
+			uploads = append(uploads, mpu)
+			return nil
+		})
+	})
+	return uploads, err
+}
+
+// saveLifecycle stores the lifecycle configuration of the bucket with the
+// ownerBucket key.
+func (r *UploadRegistry) saveLifecycle(key string, config *LifecycleConfiguration) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(lifecycleBucket).Put([]byte(key), data)
+	})
+}
+
+func (r *UploadRegistry) deleteLifecycle(key string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(lifecycleBucket).Delete([]byte(key))
+	})
+}
+
+// loadLifecycles returns the lifecycle configuration of every bucket that
+// has one, keyed by ownerBucket.
+func (r *UploadRegistry) loadLifecycles() (map[string]*LifecycleConfiguration, error) {
+	configs := make(map[string]*LifecycleConfiguration)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(lifecycleBucket).ForEach(func(k, v []byte) error {
+			config := &LifecycleConfiguration{}
+			if err := json.Unmarshal(v, config); err != nil {
+				logrus.Errorf("[Lifecycle]Registry record %s err:%s\n", k, err)
+				return nil
+			}
+			configs[string(k)] = config
+			return nil
+		})
+	})
+	return configs, err
+}
+
+// upgradePart fills in the MD5 and size of a part recorded before they were
+// tracked, from its ETag and the part file in the cache.
+func upgradePart(mpu *multipartUpload, part *multipartUploadPart) {
+	part.MD5, _ = hex.DecodeString(strings.Trim(part.ETag, `"`))
+	if info, err := os.Stat(filepath.Join(mpu.partDir(), strconv.Itoa(part.PartNumber))); err == nil {
+		part.Size = info.Size()
+	}
+}
@@ -49,6 +49,14 @@ func (g *Yts3) routeBase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	//hdr.Set("Content-Length", r.Header.Get("Content-Length"))
+	if isPresignedRequest(query) && !presignedObjectRequest(object, query) {
+		g.httpError(w, r, ErrorMessage(ErrAccessDenied, "presigned URLs are only supported for object operations"))
+		return
+	}
+	if err := g.authorizeRequest(bucket, object, r); err != nil {
+		g.httpError(w, r, err)
+		return
+	}
 	if uploadID := UploadID(query.Get("uploadId")); uploadID != "" {
 		err = g.routeMultipartUpload(bucket, object, uploadID, w, r)
 
@@ -56,13 +64,16 @@ func (g *Yts3) routeBase(w http.ResponseWriter, r *http.Request) {
 		err = g.routeMultipartUploadBase(bucket, object, w, r)
 
 	} else if _, ok := query["versioning"]; ok {
-		// err = g.routeVersioning(bucket, w, r)
+		err = g.routeVersioning(bucket, w, r)
 
 	} else if _, ok := query["versions"]; ok {
-		// err = g.routeVersions(bucket, w, r)
+		err = g.routeVersions(bucket, w, r)
+
+	} else if _, ok := query["lifecycle"]; ok && object == "" {
+		err = g.routeLifecycle(bucket, w, r)
 
 	} else if versionID := versionFromQuery(query["versionId"]); versionID != "" {
-		// err = g.routeVersion(bucket, object, VersionID(versionID), w, r)
+		err = g.routeVersion(bucket, object, VersionID(versionID), w, r)
 
 	} else if bucket != "" && object != "" {
 		err = g.routeObject(bucket, object, w, r)
@@ -100,6 +111,12 @@ func (g *Yts3) routeMultipartUpload(bucket, object string, uploadID UploadID, w
 // routeObject oandles URLs that contain both a bucket path segment and an
 // object path segment.
 func (g *Yts3) routeObject(bucket, object string, w http.ResponseWriter, r *http.Request) (err error) {
+	if _, ok := r.URL.Query()["tagging"]; ok {
+		return g.routeObjectTagging(bucket, object, "", w, r)
+	}
+	if _, ok := r.URL.Query()["acl"]; ok {
+		return g.routeObjectACL(bucket, object, "", w, r)
+	}
 	switch r.Method {
 	case "GET":
 		return g.getObject(bucket, object, "", w, r)
@@ -118,6 +135,15 @@ func (g *Yts3) routeObject(bucket, object string, w http.ResponseWriter, r *http
 // routeBucket handles URLs that contain only a bucket path segment, not an
 // object path segment.
 func (g *Yts3) routeBucket(bucket string, w http.ResponseWriter, r *http.Request) (err error) {
+	if _, ok := r.URL.Query()["tagging"]; ok {
+		return g.routeBucketTagging(bucket, w, r)
+	}
+	if _, ok := r.URL.Query()["policy"]; ok {
+		return g.routeBucketPolicy(bucket, w, r)
+	}
+	if _, ok := r.URL.Query()["acl"]; ok {
+		return g.routeBucketACL(bucket, w, r)
+	}
 	switch r.Method {
 	case "GET":
 		if _, ok := r.URL.Query()["location"]; ok {
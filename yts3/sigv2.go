@@ -0,0 +1,207 @@
+package yts3
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const signV2Algorithm = "AWS"
+
+// signV2Subresources are the query parameters that are part of the
+// CanonicalizedResource of a SigV2 string to sign.
+var signV2Subresources = map[string]bool{
+	"acl":                          true,
+	"cors":                         true,
+	"delete":                       true,
+	"lifecycle":                    true,
+	"location":                     true,
+	"logging":                      true,
+	"notification":                 true,
+	"partNumber":                   true,
+	"policy":                       true,
+	"requestPayment":               true,
+	"response-cache-control":       true,
+	"response-content-disposition": true,
+	"response-content-encoding":    true,
+	"response-content-language":    true,
+	"response-content-type":        true,
+	"response-expires":             true,
+	"restore":                      true,
+	"tagging":                      true,
+	"torrent":                      true,
+	"uploadId":                     true,
+	"uploads":                      true,
+	"versionId":                    true,
+	"versioning":                   true,
+	"versions":                     true,
+	"website":                      true,
+}
+
+// isSignatureV2 reports whether an Authorization header has the SigV2 shape
+// "AWS AccessKey:Signature".
+func isSignatureV2(auth string) bool {
+	return strings.HasPrefix(auth, signV2Algorithm+" ")
+}
+
+func isPresignedV2(query url.Values) bool {
+	_, ok := query["AWSAccessKeyId"]
+	return ok && query.Get("Signature") != ""
+}
+
+// verifySignatureV2 checks an "AWS AccessKey:Signature" Authorization header.
+// bucket is the bucket taken from the host name for virtual-hosted style
+// requests, empty for path style requests. The request date must be within
+// skew of now.
+func verifySignatureV2(rq *http.Request, credentials CredentialProvider, bucket string, now time.Time, skew time.Duration) (*Credential, error) {
+	auth := strings.TrimSpace(rq.Header.Get("Authorization")[len(signV2Algorithm)+1:])
+	idx := strings.LastIndex(auth, ":")
+	if idx <= 0 || idx == len(auth)-1 {
+		return nil, ErrorMessage(ErrAuthorizationHeaderMalformed, "authorization header must be \"AWS AccessKey:Signature\"")
+	}
+	accessKey, signature := auth[:idx], auth[idx+1:]
+	// x-amz-date takes the place of Date, which is then signed empty.
+	date := rq.Header.Get("Date")
+	signed := rq.Header.Get("X-Amz-Date")
+	if signed != "" {
+		date = ""
+	} else {
+		signed = date
+	}
+	signedAt, err := parseRequestDate(signed)
+	if err != nil {
+		return nil, ErrorMessage(ErrAccessDenied, "AWS authentication requires a valid Date or x-amz-date header")
+	}
+	if err := checkRequestTime(signedAt, now, skew); err != nil {
+		return nil, err
+	}
+	cred, err := credentials.Credential(accessKey)
+	if err != nil {
+		return nil, err
+	}
+	stringToSign := stringToSignV2(rq, date, bucket)
+	if hmac.Equal([]byte(signV2(cred.SecretKey, stringToSign)), []byte(signature)) {
+		return cred, nil
+	}
+	if date == "" {
+		// Some clients, like the examples of the S3 documentation, sign the
+		// x-amz-date in place of Date rather than as an x-amz- header.
+		alt := *rq
+		alt.Header = rq.Header.Clone()
+		alt.Header.Del("X-Amz-Date")
+		if hmac.Equal([]byte(signV2(cred.SecretKey, stringToSignV2(&alt, signed, bucket))), []byte(signature)) {
+			return cred, nil
+		}
+	}
+	logrus.Warnf("[Auth]signature v2 mismatch for %s,string to sign:\n%s\n", accessKey, stringToSign)
+	return nil, ResourceError(ErrSignatureDoesNotMatch, rq.URL.Path)
+}
+
+// verifyPresignedV2 checks a SigV2 presigned URL (AWSAccessKeyId, Expires
+// and Signature query parameters).
+func verifyPresignedV2(rq *http.Request, credentials CredentialProvider, bucket string, now time.Time) (*Credential, error) {
+	switch rq.Method {
+	case http.MethodGet, http.MethodPut, http.MethodHead, http.MethodDelete:
+	default:
+		return nil, ErrorMessagef(ErrAccessDenied, "presigned URLs are not supported for %s", rq.Method)
+	}
+	query := rq.URL.Query()
+	expiresStr := query.Get("Expires")
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil {
+		return nil, ErrorMessage(ErrAccessDenied, "Expires must be a number of seconds since the epoch")
+	}
+	if now.After(time.Unix(expires, 0)) {
+		return nil, ErrorMessage(ErrAccessDenied, "Request has expired")
+	}
+	accessKey := query.Get("AWSAccessKeyId")
+	cred, err := credentials.Credential(accessKey)
+	if err != nil {
+		return nil, err
+	}
+	stringToSign := stringToSignV2(rq, expiresStr, bucket)
+	if !hmac.Equal([]byte(signV2(cred.SecretKey, stringToSign)), []byte(query.Get("Signature"))) {
+		logrus.Warnf("[Auth]presigned signature v2 mismatch for %s,string to sign:\n%s\n", accessKey, stringToSign)
+		return nil, ResourceError(ErrSignatureDoesNotMatch, rq.URL.Path)
+	}
+	return cred, nil
+}
+
+func signV2(secret, stringToSign string) string {
+	h := hmac.New(sha1.New, []byte(secret))
+	h.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// stringToSignV2 builds:
+//
+//	HTTP-Verb\nContent-MD5\nContent-Type\nDate\nCanonicalizedAmzHeaders CanonicalizedResource
+func stringToSignV2(rq *http.Request, date, bucket string) string {
+	var buf strings.Builder
+	buf.WriteString(rq.Method)
+	buf.WriteByte('\n')
+	buf.WriteString(rq.Header.Get("Content-MD5"))
+	buf.WriteByte('\n')
+	buf.WriteString(rq.Header.Get("Content-Type"))
+	buf.WriteByte('\n')
+	buf.WriteString(date)
+	buf.WriteByte('\n')
+	buf.WriteString(canonicalAmzHeadersV2(rq.Header))
+	buf.WriteString(canonicalResourceV2(rq.URL, bucket))
+	return buf.String()
+}
+
+func canonicalAmzHeadersV2(header http.Header) string {
+	var names []string
+	for name := range header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	var buf strings.Builder
+	for _, name := range names {
+		values := append([]string(nil), header.Values(name)...)
+		for i, v := range values {
+			values[i] = strings.Join(strings.Fields(v), " ")
+		}
+		buf.WriteString(name)
+		buf.WriteByte(':')
+		buf.WriteString(strings.Join(values, ","))
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+func canonicalResourceV2(u *url.URL, bucket string) string {
+	resource := u.EscapedPath()
+	if bucket != "" {
+		resource = "/" + bucket + resource
+	}
+	query := u.Query()
+	var keys []string
+	for k := range query {
+		if signV2Subresources[k] {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return resource
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		if v := query.Get(k); v != "" {
+			keys[i] = k + "=" + v
+		}
+	}
+	return resource + "?" + strings.Join(keys, "&")
+}
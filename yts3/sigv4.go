@@ -0,0 +1,318 @@
+package yts3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	signV4Algorithm = "AWS4-HMAC-SHA256"
+	iso8601Format   = "20060102T150405Z"
+	yyyymmdd        = "20060102"
+)
+
+// PublicKeyFromAccessKey extracts the YottaChain public key from an S3
+// access key id of the form "YTA<publicKey>" or "YTA<publicKey>:<suffix>".
+func PublicKeyFromAccessKey(accessKeyID string) string {
+	publicKey := strings.TrimPrefix(accessKeyID, "YTA")
+	if idx := strings.Index(publicKey, ":"); idx >= 0 {
+		publicKey = publicKey[:idx]
+	}
+	return publicKey
+}
+
+type credentialScope struct {
+	accessKey string
+	date      string
+	region    string
+	service   string
+}
+
+func (c credentialScope) String() string {
+	return c.date + "/" + c.region + "/" + c.service + "/aws4_request"
+}
+
+func parseCredential(in string) (cred credentialScope, err error) {
+	parts := strings.Split(strings.TrimSpace(in), "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" {
+		return cred, ErrorMessagef(ErrAuthorizationHeaderMalformed, "invalid credential %q", in)
+	}
+	cred = credentialScope{
+		accessKey: parts[0],
+		date:      parts[1],
+		region:    parts[2],
+		service:   parts[3],
+	}
+	if cred.accessKey == "" {
+		return cred, ErrorMessage(ErrAuthorizationHeaderMalformed, "missing access key id")
+	}
+	if _, err := time.Parse(yyyymmdd, cred.date); err != nil {
+		return cred, ErrorMessagef(ErrAuthorizationHeaderMalformed, "invalid credential date %q", cred.date)
+	}
+	return cred, nil
+}
+
+type signatureV4 struct {
+	credential    credentialScope
+	signedHeaders []string
+	signature     string
+}
+
+// parseSignatureV4 parses an Authorization header of the form:
+//
+//	AWS4-HMAC-SHA256 Credential=AK/20060102/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-date, Signature=abcd
+func parseSignatureV4(auth string) (sig signatureV4, err error) {
+	if !strings.HasPrefix(auth, signV4Algorithm) {
+		return sig, ErrorMessage(ErrAuthorizationHeaderMalformed, "unsupported authorization algorithm")
+	}
+	fields := strings.Split(strings.TrimSpace(auth[len(signV4Algorithm):]), ",")
+	if len(fields) != 3 {
+		return sig, ErrorMessage(ErrAuthorizationHeaderMalformed, "authorization header requires Credential, SignedHeaders and Signature")
+	}
+	for _, field := range fields {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			return sig, ErrorMessagef(ErrAuthorizationHeaderMalformed, "invalid authorization field %q", field)
+		}
+		switch kv[0] {
+		case "Credential":
+			if sig.credential, err = parseCredential(kv[1]); err != nil {
+				return sig, err
+			}
+		case "SignedHeaders":
+			sig.signedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			sig.signature = kv[1]
+		default:
+			return sig, ErrorMessagef(ErrAuthorizationHeaderMalformed, "unexpected authorization field %q", kv[0])
+		}
+	}
+	if len(sig.signedHeaders) == 0 || sig.signature == "" {
+		return sig, ErrorMessage(ErrAuthorizationHeaderMalformed, "authorization header requires Credential, SignedHeaders and Signature")
+	}
+	return sig, nil
+}
+
+// verifySignatureV4 checks the AWS Signature Version 4 carried in the
+// Authorization header of rq and returns the credential that signed it. The
+// request date must be within skew of now.
+func verifySignatureV4(rq *http.Request, credentials CredentialProvider, now time.Time, skew time.Duration) (*Credential, error) {
+	sig, err := parseSignatureV4(rq.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+	var signedAt time.Time
+	amzDate := rq.Header.Get("X-Amz-Date")
+	if amzDate != "" {
+		signedAt, err = time.Parse(iso8601Format, amzDate)
+	} else if signedAt, err = parseRequestDate(rq.Header.Get("Date")); err == nil {
+		// The string to sign always carries the ISO8601 form of the date.
+		amzDate = signedAt.UTC().Format(iso8601Format)
+	}
+	if err != nil {
+		return nil, ErrorMessage(ErrAccessDenied, "AWS authentication requires a valid Date or x-amz-date header")
+	}
+	if err := checkRequestTime(signedAt, now, skew); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(amzDate, sig.credential.date) {
+		return nil, ErrorMessage(ErrAuthorizationHeaderMalformed, "credential date does not match x-amz-date")
+	}
+	payloadHash := rq.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		return nil, ErrorMessage(ErrInvalidRequest, "missing required header for this request: x-amz-content-sha256")
+	}
+	cred, err := credentials.Credential(sig.credential.accessKey)
+	if err != nil {
+		return nil, err
+	}
+	canonical := canonicalRequestV4(rq, rq.URL.Query(), sig.signedHeaders, payloadHash)
+	expected := signV4(cred.SecretKey, sig.credential, amzDate, canonical)
+	if !hmac.Equal([]byte(expected), []byte(sig.signature)) {
+		logrus.Warnf("[Auth]signature mismatch for %s,canonical request:\n%s\n", sig.credential.accessKey, canonical)
+		return nil, ResourceError(ErrSignatureDoesNotMatch, rq.URL.Path)
+	}
+	if payloadHash == streamingPayload {
+		decoded, err := strconv.ParseInt(rq.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil || decoded < 0 {
+			return nil, ErrMissingContentLength
+		}
+		signer := &chunkSigner{
+			key:      signingKeyV4(cred.SecretKey, sig.credential),
+			amzDate:  amzDate,
+			scope:    sig.credential.String(),
+			previous: sig.signature,
+		}
+		rq.Body = newChunkedReader(rq.Body, signer, decoded)
+	} else if len(payloadHash) == sha256.Size*2 {
+		if expected, err := hex.DecodeString(payloadHash); err == nil {
+			rq.Body = &sha256Reader{inner: rq.Body, expected: expected, hash: sha256.New()}
+		}
+	}
+	return cred, nil
+}
+
+// checkRequestTime rejects a request signed at signedAt if it is more than
+// skew away from now. A zero skew disables the check.
+func checkRequestTime(signedAt, now time.Time, skew time.Duration) error {
+	if skew == 0 {
+		return nil
+	}
+	if d := now.Sub(signedAt); d < -skew || d > skew {
+		return requestTimeTooSkewed(now, skew)
+	}
+	return nil
+}
+
+func signV4(secret string, cred credentialScope, amzDate, canonicalRequest string) string {
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := signV4Algorithm + "\n" +
+		amzDate + "\n" +
+		cred.String() + "\n" +
+		hex.EncodeToString(hashed[:])
+	key := signingKeyV4(secret, cred)
+	return hex.EncodeToString(hmacSHA256(key, []byte(stringToSign)))
+}
+
+func signingKeyV4(secret string, cred credentialScope) []byte {
+	date := hmacSHA256([]byte("AWS4"+secret), []byte(cred.date))
+	region := hmacSHA256(date, []byte(cred.region))
+	service := hmacSHA256(region, []byte(cred.service))
+	return hmacSHA256(service, []byte("aws4_request"))
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func canonicalRequestV4(rq *http.Request, query url.Values, signedHeaders []string, payloadHash string) string {
+	var buf bytes.Buffer
+	buf.WriteString(rq.Method)
+	buf.WriteByte('\n')
+	buf.WriteString(canonicalURI(rq.URL))
+	buf.WriteByte('\n')
+	buf.WriteString(canonicalQuery(query))
+	buf.WriteByte('\n')
+	for _, name := range signedHeaders {
+		buf.WriteString(name)
+		buf.WriteByte(':')
+		buf.WriteString(canonicalHeaderValue(rq, name))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	buf.WriteString(strings.Join(signedHeaders, ";"))
+	buf.WriteByte('\n')
+	buf.WriteString(payloadHash)
+	return buf.String()
+}
+
+// canonicalURI re-encodes each path segment with the S3 flavour of
+// URI encoding. Segments are unescaped first so that keys containing an
+// encoded '/' keep it encoded.
+func canonicalURI(u *url.URL) string {
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, seg := range segments {
+		if unescaped, err := url.PathUnescape(seg); err == nil {
+			seg = unescaped
+		}
+		segments[i] = uriEncode(seg)
+	}
+	out := strings.Join(segments, "/")
+	if out == "" {
+		out = "/"
+	}
+	return out
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func canonicalHeaderValue(rq *http.Request, name string) string {
+	var values []string
+	switch name {
+	case "host":
+		values = []string{rq.Host}
+	case "content-length":
+		values = append(values, rq.Header.Values(name)...)
+		if len(values) == 0 && rq.ContentLength >= 0 {
+			values = []string{strconv.FormatInt(rq.ContentLength, 10)}
+		}
+	default:
+		values = append(values, rq.Header.Values(name)...)
+	}
+	for i, v := range values {
+		values[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(values, ",")
+}
+
+// uriEncode implements the URI encoding described in the SigV4
+// documentation: every byte except the unreserved characters A-Z, a-z,
+// 0-9, '-', '.', '_' and '~' is percent-encoded with upper case hex.
+func uriEncode(in string) string {
+	const hexUpper = "0123456789ABCDEF"
+	var buf strings.Builder
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			buf.WriteByte(c)
+			continue
+		}
+		buf.WriteByte('%')
+		buf.WriteByte(hexUpper[c>>4])
+		buf.WriteByte(hexUpper[c&15])
+	}
+	return buf.String()
+}
+
+// sha256Reader verifies the x-amz-content-sha256 the client signed against
+// the body that was actually received.
+type sha256Reader struct {
+	inner    io.ReadCloser
+	expected []byte
+	hash     hash.Hash
+}
+
+func (s *sha256Reader) Read(p []byte) (n int, err error) {
+	n, err = s.inner.Read(p)
+	if n > 0 {
+		s.hash.Write(p[:n])
+	}
+	if err == io.EOF && !bytes.Equal(s.hash.Sum(nil), s.expected) {
+		return n, ErrXAmzContentSHA256Mismatch
+	}
+	return n, err
+}
+
+func (s *sha256Reader) Close() error {
+	return s.inner.Close()
+}
@@ -1,6 +1,9 @@
 package yts3
 
-import "time"
+import (
+	"net/http"
+	"time"
+)
 
 type TimeSource interface {
 	Now() time.Time
@@ -55,3 +58,17 @@ func (l *fixedTimeSource) Since(t time.Time) time.Duration {
 func (l *fixedTimeSource) Advance(by time.Duration) {
 	l.time = l.time.Add(by)
 }
+
+// parseRequestDate parses the Date or x-amz-date of a signed request. The
+// HTTP formats are accepted, and the numeric zone many clients use instead
+// of "GMT", as in "Tue, 27 Mar 2007 19:36:42 +0000".
+func parseRequestDate(s string) (time.Time, error) {
+	t, err := http.ParseTime(s)
+	if err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC1123Z, s); err == nil {
+		return t, nil
+	}
+	return t, err
+}
@@ -2,15 +2,18 @@ package yts3
 
 import (
 	"crypto/md5"
+	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"math/big"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ryszard/goskiplist/skiplist"
@@ -19,7 +22,12 @@ import (
 	"github.com/yottachain/YTS3/internal/goskipiter"
 )
 
-var add1 = new(big.Int).SetInt64(1)
+// multipartCacheDir is the directory under the S3 cache holding the part
+// directories of the multipart uploads. It is not a valid bucket name.
+const multipartCacheDir = "_multipart"
+
+// s3Cache returns the S3 cache directory, which holds the part files.
+var s3Cache = env.GetS3Cache
 
 type bucketUploads struct {
 	uploads map[UploadID]*multipartUpload
@@ -73,44 +81,117 @@ func (bu *bucketUploads) remove(uploadID UploadID) {
 	}
 }
 
-type uploader struct {
-	uploadID *big.Int
+// ownerBucket is the key of the uploads and lifecycle rules of a bucket.
+// Buckets are only unique per owner, so the owner's public key is part of it.
+func ownerBucket(owner, bucket string) string {
+	return owner + "/" + bucket
+}
+
+// newUploadID returns a random upload ID, so that the uploads of other users
+// cannot be guessed.
+func newUploadID() (UploadID, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return UploadID(hex.EncodeToString(b[:])), nil
+}
 
+// uploader tracks the multipart uploads in progress. Every upload belongs
+// to the public key that initiated it; the other users cannot see or change
+// it, and get ErrNoSuchUpload as if it did not exist.
+type uploader struct {
+	// buckets holds the uploads of each bucket, keyed by ownerBucket.
 	buckets map[string]*bucketUploads
 	mu      sync.Mutex
+
+	// registry, if set, persists every change to the uploads.
+	registry *UploadRegistry
+
+	// configs, if set, keeps the bucket lifecycle rules with the bucket, so
+	// that they apply on every gateway.
+	configs BucketConfigBackend
+
+	// lifecycles holds the bucket lifecycle rules kept by the gateway itself,
+	// keyed by ownerBucket: all of them without configs, otherwise only the
+	// rules set before the Backend kept them.
+	lifecycles map[string]*LifecycleConfiguration
 }
 
 func newUploader() *uploader {
 	return &uploader{
-		buckets:  make(map[string]*bucketUploads),
-		uploadID: new(big.Int),
+		buckets:    make(map[string]*bucketUploads),
+		lifecycles: make(map[string]*LifecycleConfiguration),
 	}
 }
 
-func (u *uploader) Begin(bucket, object string, meta map[string]string, initiated time.Time) *multipartUpload {
+// restore rebuilds the uploader from registry and keeps persisting to it.
+func (u *uploader) restore(registry *UploadRegistry) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.registry = registry
+	uploads, err := registry.load()
+	if err != nil {
+		return err
+	}
+	for _, mpu := range uploads {
+		mpu.registry = registry
+		if mpu.Owner == "" {
+			// Recorded before uploads had owners; nobody can resume it, so
+			// it is left for the reaper.
+			logrus.Warnf("[MultipartUpload]Upload %s of /%s/%s has no owner\n", mpu.ID, mpu.Bucket, mpu.Object)
+		}
+		u.addUnlocked(mpu)
+	}
+	logrus.Infof("[MultipartUpload]Restored %d uploads\n", len(uploads))
+	lifecycles, err := registry.loadLifecycles()
+	if err != nil {
+		return err
+	}
+	u.lifecycles = lifecycles
+	return nil
+}
+
+func (u *uploader) Begin(owner, bucket, object string, meta map[string]string, initiated time.Time) (*multipartUpload, error) {
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
 	u.mu.Lock()
 	defer u.mu.Unlock()
-	u.uploadID.Add(u.uploadID, add1)
 	mpu := &multipartUpload{
-		ID:        UploadID(u.uploadID.String()),
+		ID:        id,
+		Owner:     owner,
 		Bucket:    bucket,
 		Object:    object,
 		Meta:      meta,
 		Initiated: initiated,
+		registry:  u.registry,
 	}
-	bucketUploads := u.buckets[bucket]
+	if u.registry != nil {
+		if err := u.registry.save(mpu); err != nil {
+			logrus.Errorf("[MultipartUpload]Registry save %s err:%s\n", mpu.ID, err)
+			return nil, err
+		}
+	}
+	u.addUnlocked(mpu)
+	return mpu, nil
+}
+
+func (u *uploader) addUnlocked(mpu *multipartUpload) {
+	key := ownerBucket(mpu.Owner, mpu.Bucket)
+	bucketUploads := u.buckets[key]
 	if bucketUploads == nil {
-		u.buckets[bucket] = newBucketUploads()
-		bucketUploads = u.buckets[bucket]
+		bucketUploads = newBucketUploads()
+		u.buckets[key] = bucketUploads
 	}
 	bucketUploads.add(mpu)
-	return mpu
 }
 
-func (u *uploader) ListParts(bucket, object string, uploadID UploadID, marker int, limit int64) (*ListMultipartUploadPartsResult, error) {
+func (u *uploader) ListParts(owner, bucket, object string, uploadID UploadID, marker int, limit int64) (*ListMultipartUploadPartsResult, error) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
-	mpu, err := u.getUnlocked(bucket, object, uploadID)
+	mpu, err := u.getUnlocked(owner, bucket, object, uploadID)
 	if err != nil {
 		return nil, err
 	}
@@ -121,32 +202,36 @@ func (u *uploader) ListParts(bucket, object string, uploadID UploadID, marker in
 		MaxParts:         limit,
 		PartNumberMarker: marker,
 		StorageClass:     "STANDARD",
+		Initiator:        mpu.ownerInfo(),
+		Owner:            mpu.ownerInfo(),
 	}
+	// The marker is the last part number of the previous page.
 	var cnt int64
-	for partNumber, part := range mpu.parts[marker:] {
+	for partNumber := marker + 1; partNumber < len(mpu.parts); partNumber++ {
+		part := mpu.parts[partNumber]
 		if part == nil {
 			continue
 		}
 		if cnt >= limit {
 			result.IsTruncated = true
-			result.NextPartNumberMarker = partNumber
 			break
 		}
 		result.Parts = append(result.Parts, ListMultipartUploadPartItem{
 			ETag:         part.ETag,
-			Size:         int64(len(part.Body)),
+			Size:         part.Size,
 			PartNumber:   partNumber,
 			LastModified: part.LastModified,
 		})
+		result.NextPartNumberMarker = partNumber
 		cnt++
 	}
 	return &result, nil
 }
 
-func (u *uploader) List(bucket string, marker *UploadListMarker, prefix Prefix, limit int64) (*ListMultipartUploadsResult, error) {
+func (u *uploader) List(owner, bucket string, marker *UploadListMarker, prefix Prefix, limit int64) (*ListMultipartUploadsResult, error) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
-	bucketUploads, ok := u.buckets[bucket]
+	bucketUploads, ok := u.buckets[ownerBucket(owner, bucket)]
 	if !ok {
 		return nil, ErrNoSuchUpload
 	}
@@ -199,6 +284,8 @@ func (u *uploader) List(bucket string, marker *UploadListMarker, prefix Prefix,
 						StorageClass: "STANDARD",
 						Key:          object,
 						UploadID:     upload.ID,
+						Initiator:    upload.ownerInfo(),
+						Owner:        upload.ownerInfo(),
 						Initiated:    ContentTime{Time: upload.Initiated},
 					})
 					cnt++
@@ -230,24 +317,62 @@ done:
 	return &result, nil
 }
 
-func (u *uploader) Complete(bucket, object string, id UploadID) (*multipartUpload, error) {
+// Complete removes an upload whose object has been stored and deletes its
+// cached parts.
+func (u *uploader) Complete(owner, bucket, object string, id UploadID) error {
 	u.mu.Lock()
-	defer u.mu.Unlock()
-	up, err := u.getUnlocked(bucket, object, id)
+	mpu, err := u.getUnlocked(owner, bucket, object, id)
 	if err != nil {
-		return nil, err
+		u.mu.Unlock()
+		return err
+	}
+	u.removeUnlocked(mpu)
+	u.mu.Unlock()
+	return mpu.discard()
+}
+
+// Abort removes the upload from the uploader and the registry and deletes
+// its cached parts. Later calls for the upload fail with ErrNoSuchUpload.
+// Uploads that are being completed cannot be aborted.
+func (u *uploader) Abort(owner, bucket, object string, id UploadID) error {
+	u.mu.Lock()
+	mpu, err := u.getUnlocked(owner, bucket, object, id)
+	if err != nil {
+		u.mu.Unlock()
+		return err
+	}
+	if !mpu.setState(uploadOpen, uploadDiscarded) {
+		u.mu.Unlock()
+		return mpu.stateError()
+	}
+	u.removeUnlocked(mpu)
+	u.mu.Unlock()
+	return mpu.discard()
+}
+
+func (u *uploader) removeUnlocked(mpu *multipartUpload) {
+	key := ownerBucket(mpu.Owner, mpu.Bucket)
+	if bucketUps, ok := u.buckets[key]; ok {
+		bucketUps.remove(mpu.ID)
+		if len(bucketUps.uploads) == 0 {
+			delete(u.buckets, key)
+		}
+	}
+	if u.registry != nil {
+		if err := u.registry.delete(mpu.ID); err != nil {
+			logrus.Errorf("[MultipartUpload]Registry delete %s err:%s\n", mpu.ID, err)
+		}
 	}
-	return up, nil
 }
 
-func (u *uploader) Get(bucket, object string, id UploadID) (mu *multipartUpload, err error) {
+func (u *uploader) Get(owner, bucket, object string, id UploadID) (mu *multipartUpload, err error) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
-	return u.getUnlocked(bucket, object, id)
+	return u.getUnlocked(owner, bucket, object, id)
 }
 
-func (u *uploader) getUnlocked(bucket, object string, id UploadID) (mu *multipartUpload, err error) {
-	bucketUps, ok := u.buckets[bucket]
+func (u *uploader) getUnlocked(owner, bucket, object string, id UploadID) (mu *multipartUpload, err error) {
+	bucketUps, ok := u.buckets[ownerBucket(owner, bucket)]
 	if !ok {
 		return nil, ErrNoSuchUpload
 	}
@@ -257,7 +382,7 @@ func (u *uploader) getUnlocked(bucket, object string, id UploadID) (mu *multipar
 		return nil, ErrNoSuchUpload
 	}
 
-	if mu.Bucket != bucket || mu.Object != object {
+	if mu.Owner != owner || mu.Bucket != bucket || mu.Object != object {
 		return nil, ErrNoSuchUpload
 	}
 
@@ -279,14 +404,21 @@ func uploadListMarkerFromQuery(q url.Values) *UploadListMarker {
 }
 
 type multipartUploadPart struct {
-	PartNumber   int
-	ETag         string
-	Body         []byte
-	LastModified ContentTime
+	PartNumber int    `json:"partNumber"`
+	ETag       string `json:"etag"`
+
+	// Size and MD5 describe the part file in the S3 cache.
+	Size int64  `json:"size"`
+	MD5  []byte `json:"md5"`
+
+	LastModified ContentTime `json:"lastModified"`
 }
 
 type multipartUpload struct {
-	ID        UploadID
+	ID UploadID
+
+	// Owner is the public key of the user that initiated the upload.
+	Owner     string
 	Bucket    string
 	Object    string
 	Meta      map[string]string
@@ -294,9 +426,73 @@ type multipartUpload struct {
 
 	parts []*multipartUploadPart
 
+	registry *UploadRegistry
+
+	// state is one of the upload states below. It is read and changed
+	// atomically, so that the uploader can check it without waiting for mu,
+	// which is held while a part is being written.
+	state int32
+
 	mu sync.Mutex
 }
 
+const (
+	// uploadOpen uploads can be given parts, completed or aborted.
+	uploadOpen int32 = iota
+
+	// uploadCompleting is set while the reassembled parts are being stored.
+	// The part files must not change meanwhile, so the upload cannot be
+	// aborted, reaped, completed again or given new parts until it is
+	// cleared.
+	uploadCompleting
+
+	// uploadDiscarded is set once the upload has been aborted, reaped or
+	// completed.
+	uploadDiscarded
+)
+
+// setState changes the state of the upload from old to new, and reports
+// whether it was old.
+func (mpu *multipartUpload) setState(old, new int32) bool {
+	return atomic.CompareAndSwapInt32(&mpu.state, old, new)
+}
+
+// stateError is the error returned for an upload that is no longer open.
+func (mpu *multipartUpload) stateError() error {
+	if atomic.LoadInt32(&mpu.state) == uploadCompleting {
+		return ResourceError(ErrOperationAborted, string(mpu.ID))
+	}
+	return ErrNoSuchUpload
+}
+
+// partDir is the directory in the S3 cache that holds the parts of the
+// upload. Every upload has its own, so concurrent uploads to the same key
+// do not overwrite each other's parts.
+func (mpu *multipartUpload) partDir() string {
+	return filepath.Join(s3Cache(), multipartCacheDir, string(mpu.ID))
+}
+
+// ownerInfo returns the initiator of the upload for the list responses, or
+// nil for uploads restored from a registry that predates owners.
+func (mpu *multipartUpload) ownerInfo() *UserInfo {
+	if mpu.Owner == "" {
+		return nil
+	}
+	return ownerInfo(mpu.Owner)
+}
+
+// discard marks the upload as finished and deletes its cached parts.
+func (mpu *multipartUpload) discard() error {
+	atomic.StoreInt32(&mpu.state, uploadDiscarded)
+	mpu.mu.Lock()
+	defer mpu.mu.Unlock()
+	if err := os.RemoveAll(mpu.partDir()); err != nil {
+		logrus.Errorf("[MultipartUpload]Remove parts of %s err:%s\n", mpu.ID, err)
+		return err
+	}
+	return nil
+}
+
 func (mpu *multipartUpload) AddPart(bucketName, objectName string, partNumber int, at time.Time, rdr io.Reader, size int64) (etag string, err error) {
 	if partNumber > MaxUploadPartNumber {
 		logrus.Infof("[MultipartUpload]AddPart  ErrInvalidPart")
@@ -304,42 +500,61 @@ func (mpu *multipartUpload) AddPart(bucketName, objectName string, partNumber in
 	}
 	mpu.mu.Lock()
 	defer mpu.mu.Unlock()
-	s3cache := env.GetS3Cache()
-	directory := s3cache + "/" + bucketName + "/" + objectName
+	if atomic.LoadInt32(&mpu.state) != uploadOpen {
+		return "", mpu.stateError()
+	}
 	partName := fmt.Sprintf("%d", partNumber)
-	etag, err3 := writeCacheFilePart(directory, objectName, partName, rdr)
-	if err3 != nil {
-		logrus.Errorf("[MultipartUpload]AddPart,write big file cache error:%s\n", err3)
-		return
+	sum, written, err := writeCacheFilePart(mpu.partDir(), objectName, partName, rdr)
+	if err != nil {
+		logrus.Errorf("[MultipartUpload]AddPart,write big file cache error:%s\n", err)
+		return "", err
+	}
+	if size >= 0 && written != size {
+		logrus.Errorf("[MultipartUpload]AddPart,part %d of %s is %d bytes,expected %d\n", partNumber, mpu.ID, written, size)
+		return "", ErrIncompleteBody
 	}
+	etag = fmt.Sprintf(`"%s"`, hex.EncodeToString(sum))
 	part := multipartUploadPart{
-		PartNumber: partNumber,
-		// Body:         body,
+		PartNumber:   partNumber,
 		ETag:         etag,
+		Size:         written,
+		MD5:          sum,
 		LastModified: NewContentTime(at),
 	}
 	if partNumber >= len(mpu.parts) {
 		mpu.parts = append(mpu.parts, make([]*multipartUploadPart, partNumber-len(mpu.parts)+1)...)
 	}
 	mpu.parts[partNumber] = &part
+	if atomic.LoadInt32(&mpu.state) == uploadDiscarded {
+		// Aborted while the part was written; the registry must not get the
+		// upload back.
+		return "", ErrNoSuchUpload
+	}
+	if mpu.registry != nil {
+		if err := mpu.registry.save(mpu); err != nil {
+			logrus.Errorf("[MultipartUpload]Registry save %s err:%s\n", mpu.ID, err)
+			return "", err
+		}
+	}
 	return etag, nil
 }
 
-func writeCacheFilePart(directory, fileName, partName string, input io.Reader) (etag string, err error) {
-	var partEtag string
+// writeCacheFilePart writes input to the part file partName in directory and
+// returns its MD5 and size.
+func writeCacheFilePart(directory, fileName, partName string, input io.Reader) (sum []byte, size int64, err error) {
 	s, err := os.Stat(directory)
 	if err != nil {
 		if !os.IsExist(err) {
 			err = os.MkdirAll(directory, os.ModePerm)
 			if err != nil {
-				return partEtag, err
+				return nil, 0, err
 			}
 		} else {
-			return partEtag, err
+			return nil, 0, err
 		}
 	} else {
 		if !s.IsDir() {
-			return partEtag, errors.New("The specified path is not a directory.")
+			return nil, 0, errors.New("The specified path is not a directory.")
 		}
 	}
 	if !strings.HasSuffix(directory, "/") {
@@ -348,8 +563,8 @@ func writeCacheFilePart(directory, fileName, partName string, input io.Reader) (
 	filePath := directory + partName
 	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
 	if err != nil {
-		logrus.Errorf("[MultipartUpload]write cache err:%s，open files:%d\n", err)
-		return partEtag, err
+		logrus.Errorf("[MultipartUpload]write cache %s err:%s\n", filePath, err)
+		return nil, 0, err
 	}
 	defer f.Close()
 	hash := md5.New()
@@ -357,46 +572,68 @@ func writeCacheFilePart(directory, fileName, partName string, input io.Reader) (
 	for {
 		num, err := input.Read(readbuf)
 		if err != nil && err != io.EOF {
-			return partEtag, err
+			return nil, 0, err
 		}
 		if num > 0 {
 			bs := readbuf[0:num]
-			f.Write(bs)
+			if _, err := f.Write(bs); err != nil {
+				return nil, 0, err
+			}
 			hash.Write(bs)
+			size += int64(num)
 		}
 		if err != nil && err == io.EOF {
 			break
 		}
 	}
-	partEtag = fmt.Sprintf(`"%s"`, hex.EncodeToString(hash.Sum(nil)))
-	return partEtag, nil
+	return hash.Sum(nil), size, nil
 }
 
-func (mpu *multipartUpload) Reassemble(input *CompleteMultipartUploadRequest) (body []byte, etag string, err error) {
+// Reassemble checks a complete request against the uploaded parts and
+// returns the cached part files to upload, in order, with their total size
+// and the S3 style ETag of the assembled object: the MD5 of the parts' MD5s,
+// followed by "-" and the number of parts. On success the upload is marked
+// as completing until Complete removes it or Resume is called.
+func (mpu *multipartUpload) Reassemble(input *CompleteMultipartUploadRequest) (files []string, size int64, etag string, err error) {
 	mpu.mu.Lock()
 	defer mpu.mu.Unlock()
-	mpuPartsLen := len(mpu.parts)
-	if len(input.Parts) > mpuPartsLen {
-		return nil, "", ErrInvalidPart
+	if atomic.LoadInt32(&mpu.state) != uploadOpen {
+		return nil, 0, "", mpu.stateError()
+	}
+	if len(input.Parts) == 0 {
+		return nil, 0, "", ErrorMessage(ErrMalformedXML, "the complete request must list at least one part")
 	}
 	if !input.partsAreSorted() {
-		return nil, "", ErrInvalidPartOrder
+		return nil, 0, "", ErrInvalidPartOrder
 	}
-	var size int64
+	hash := md5.New()
 	for _, inPart := range input.Parts {
-		if inPart.PartNumber >= mpuPartsLen || mpu.parts[inPart.PartNumber] == nil {
-			return nil, "", ErrorMessagef(ErrInvalidPart, "unexpected part number %d in complete request", inPart.PartNumber)
+		if inPart.PartNumber <= 0 || inPart.PartNumber >= len(mpu.parts) || mpu.parts[inPart.PartNumber] == nil {
+			return nil, 0, "", ErrorMessagef(ErrInvalidPart, "unexpected part number %d in complete request", inPart.PartNumber)
 		}
 		upPart := mpu.parts[inPart.PartNumber]
-		// if inPart.ETag != upPart.ETag {
-		// 	return nil, "", ErrorMessagef(ErrInvalidPart, "unexpected part etag for number %d in complete request", inPart.PartNumber)
-		// }
-		size += int64(len(upPart.Body))
-	}
-	body = make([]byte, 0, size)
-	// for _, part := range input.Parts {
-	// 	body = append(body, mpu.parts[part.PartNumber].Body...)
-	// }
-	hash := fmt.Sprintf("%x", md5.Sum(body))
-	return nil, hash, nil
+		if strings.Trim(inPart.ETag, `"`) != strings.Trim(upPart.ETag, `"`) {
+			return nil, 0, "", ErrorMessagef(ErrInvalidPart, "unexpected part etag for number %d in complete request", inPart.PartNumber)
+		}
+		hash.Write(upPart.MD5)
+		file := filepath.Join(mpu.partDir(), strconv.Itoa(inPart.PartNumber))
+		info, err := os.Stat(file)
+		if err != nil || info.Size() != upPart.Size {
+			logrus.Errorf("[MultipartUpload]Part %d of %s does not match the cache,err:%v\n", inPart.PartNumber, mpu.ID, err)
+			return nil, 0, "", ErrorMessagef(ErrInvalidPart, "part number %d is missing from the cache", inPart.PartNumber)
+		}
+		files = append(files, file)
+		size += upPart.Size
+	}
+	etag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(hash.Sum(nil)), len(input.Parts))
+	if !mpu.setState(uploadOpen, uploadCompleting) {
+		return nil, 0, "", mpu.stateError()
+	}
+	return files, size, etag, nil
+}
+
+// Resume clears the completing mark of an upload whose object could not be
+// stored, so that the client can retry, add parts or abort it.
+func (mpu *multipartUpload) Resume() {
+	mpu.setState(uploadCompleting, uploadOpen)
 }
@@ -0,0 +1,413 @@
+package yts3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var uploadTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// withCache points the S3 cache at a temporary directory for the test.
+func withCache(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	prev := s3Cache
+	s3Cache = func() string { return dir }
+	t.Cleanup(func() { s3Cache = prev })
+	return dir
+}
+
+func addPart(t *testing.T, mpu *multipartUpload, partNumber int, data string) string {
+	t.Helper()
+	etag, err := mpu.AddPart(mpu.Bucket, mpu.Object, partNumber, uploadTime, strings.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("part %d: %v", partNumber, err)
+	}
+	return etag
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploaderStates(t *testing.T) {
+	withCache(t)
+	u := newUploader()
+	mpu, err := u.Begin("owner", "bucket", "object", nil, uploadTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	complete := &CompleteMultipartUploadRequest{Parts: []CompletedPart{
+		{PartNumber: 1, ETag: addPart(t, mpu, 1, "hello ")},
+		{PartNumber: 2, ETag: addPart(t, mpu, 2, "world")},
+	}}
+
+	// While the parts are being stored, the upload cannot change.
+	if _, _, _, err := mpu.Reassemble(complete); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mpu.AddPart("bucket", "object", 3, uploadTime, strings.NewReader("!"), 1); !HasErrorCode(err, ErrOperationAborted) {
+		t.Fatalf("add part while completing: expected %q, got %v", ErrOperationAborted, err)
+	}
+	if _, _, _, err := mpu.Reassemble(complete); !HasErrorCode(err, ErrOperationAborted) {
+		t.Fatalf("reassemble while completing: expected %q, got %v", ErrOperationAborted, err)
+	}
+	if err := u.Abort("owner", "bucket", "object", mpu.ID); !HasErrorCode(err, ErrOperationAborted) {
+		t.Fatalf("abort while completing: expected %q, got %v", ErrOperationAborted, err)
+	}
+	if n, _ := u.Reap(uploadTime.Add(time.Hour), time.Minute); n != 0 {
+		t.Fatalf("reaped %d uploads while completing", n)
+	}
+
+	// Once resumed it can be given parts again.
+	mpu.Resume()
+	addPart(t, mpu, 3, "!")
+	if _, _, _, err := mpu.Reassemble(complete); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Complete("owner", "bucket", "object", mpu.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(mpu.partDir()); !os.IsNotExist(err) {
+		t.Fatalf("expected the parts to be deleted, got %v", err)
+	}
+	if _, err := u.Get("owner", "bucket", "object", mpu.ID); err != ErrNoSuchUpload {
+		t.Fatalf("get completed upload: expected %q, got %v", ErrNoSuchUpload, err)
+	}
+	if _, err := mpu.AddPart("bucket", "object", 4, uploadTime, strings.NewReader("!"), 1); err != ErrNoSuchUpload {
+		t.Fatalf("add part to completed upload: expected %q, got %v", ErrNoSuchUpload, err)
+	}
+	if err := u.Complete("owner", "bucket", "object", mpu.ID); err != ErrNoSuchUpload {
+		t.Fatalf("complete twice: expected %q, got %v", ErrNoSuchUpload, err)
+	}
+}
+
+func TestUploaderAbort(t *testing.T) {
+	withCache(t)
+	u := newUploader()
+	mpu, err := u.Begin("owner", "bucket", "object", nil, uploadTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addPart(t, mpu, 1, "data")
+
+	for _, tc := range []struct {
+		owner, bucket, object string
+	}{
+		{"other", "bucket", "object"},
+		{"owner", "other", "object"},
+		{"owner", "bucket", "other"},
+	} {
+		if err := u.Abort(tc.owner, tc.bucket, tc.object, mpu.ID); err != ErrNoSuchUpload {
+			t.Fatalf("abort as %v: expected %q, got %v", tc, ErrNoSuchUpload, err)
+		}
+	}
+	if err := u.Abort("owner", "bucket", "object", mpu.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(mpu.partDir()); !os.IsNotExist(err) {
+		t.Fatalf("expected the parts to be deleted, got %v", err)
+	}
+	if err := u.Abort("owner", "bucket", "object", mpu.ID); err != ErrNoSuchUpload {
+		t.Fatalf("abort twice: expected %q, got %v", ErrNoSuchUpload, err)
+	}
+	if _, err := mpu.AddPart("bucket", "object", 2, uploadTime, strings.NewReader("data"), 4); err != ErrNoSuchUpload {
+		t.Fatalf("add part to aborted upload: expected %q, got %v", ErrNoSuchUpload, err)
+	}
+	if _, _, _, err := mpu.Reassemble(&CompleteMultipartUploadRequest{Parts: []CompletedPart{{PartNumber: 1}}}); err != ErrNoSuchUpload {
+		t.Fatalf("reassemble aborted upload: expected %q, got %v", ErrNoSuchUpload, err)
+	}
+}
+
+func TestUploaderAddPart(t *testing.T) {
+	withCache(t)
+	u := newUploader()
+	mpu, err := u.Begin("owner", "bucket", "object", nil, uploadTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name       string
+		partNumber int
+		data       string
+		size       int64
+		etag       string
+		err        error
+	}{
+		{"first", 1, "data", 4, `"` + md5Hex("data") + `"`, nil},
+		{"unknown size", 2, "more data", -1, `"` + md5Hex("more data") + `"`, nil},
+		{"replaced", 1, "new data", 8, `"` + md5Hex("new data") + `"`, nil},
+		{"last", MaxUploadPartNumber, "x", 1, `"` + md5Hex("x") + `"`, nil},
+		{"too high", MaxUploadPartNumber + 1, "x", 1, "", ErrInvalidPart},
+		{"short", 3, "dat", 4, "", ErrIncompleteBody},
+		{"long", 3, "datum", 4, "", ErrIncompleteBody},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			etag, err := mpu.AddPart("bucket", "object", tc.partNumber, uploadTime, strings.NewReader(tc.data), tc.size)
+			if err != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if etag != tc.etag {
+				t.Fatalf("expected etag %s, got %s", tc.etag, etag)
+			}
+		})
+	}
+	data, err := ioutil.ReadFile(filepath.Join(mpu.partDir(), "1"))
+	if err != nil || string(data) != "new data" {
+		t.Fatalf("expected part 1 to hold %q, got %q, %v", "new data", data, err)
+	}
+}
+
+func TestUploaderReassemble(t *testing.T) {
+	withCache(t)
+	u := newUploader()
+	mpu, err := u.Begin("owner", "bucket", "object", nil, uploadTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag1 := addPart(t, mpu, 1, "hello ")
+	etag2 := addPart(t, mpu, 2, "world")
+	etag5 := addPart(t, mpu, 5, "!")
+
+	// The ETag S3 gives an object uploaded in parts: the MD5 of the MD5s of
+	// the parts, followed by the number of parts.
+	sum1, _ := hex.DecodeString(md5Hex("hello "))
+	sum5, _ := hex.DecodeString(md5Hex("!"))
+	compositeETag := fmt.Sprintf(`"%s-2"`, md5Hex(string(sum1)+string(sum5)))
+
+	for _, tc := range []struct {
+		name  string
+		parts []CompletedPart
+		size  int64
+		etag  string
+		err   ErrorCode
+	}{
+		{"no parts", nil, 0, "", ErrMalformedXML},
+		{"unsorted", []CompletedPart{{2, etag2}, {1, etag1}}, 0, "", ErrInvalidPartOrder},
+		{"repeated", []CompletedPart{{1, etag1}, {1, etag1}}, 0, "", ErrInvalidPartOrder},
+		{"unknown part", []CompletedPart{{1, etag1}, {3, etag5}}, 0, "", ErrInvalidPart},
+		{"part zero", []CompletedPart{{0, etag1}}, 0, "", ErrInvalidPart},
+		{"past the last part", []CompletedPart{{6, etag5}}, 0, "", ErrInvalidPart},
+		{"wrong etag", []CompletedPart{{1, etag2}}, 0, "", ErrInvalidPart},
+		{"unquoted etag", []CompletedPart{{1, strings.Trim(etag1, `"`)}, {5, etag5}}, 7, compositeETag, ErrNone},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			files, size, etag, err := mpu.Reassemble(&CompleteMultipartUploadRequest{Parts: tc.parts})
+			if !HasErrorCode(err, tc.err) {
+				t.Fatalf("expected %q, got %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+			defer mpu.Resume()
+			if size != tc.size || etag != tc.etag {
+				t.Fatalf("expected %d bytes with etag %s, got %d bytes with etag %s", tc.size, tc.etag, size, etag)
+			}
+			if len(files) != len(tc.parts) {
+				t.Fatalf("expected %d files, got %v", len(tc.parts), files)
+			}
+			for i, part := range tc.parts {
+				if files[i] != filepath.Join(mpu.partDir(), fmt.Sprint(part.PartNumber)) {
+					t.Fatalf("expected file %d to be part %d, got %s", i, part.PartNumber, files[i])
+				}
+			}
+		})
+	}
+
+	// A part file that went missing from the cache fails the completion.
+	if err := os.Remove(filepath.Join(mpu.partDir(), "2")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := mpu.Reassemble(&CompleteMultipartUploadRequest{Parts: []CompletedPart{{1, etag1}, {2, etag2}}}); !HasErrorCode(err, ErrInvalidPart) {
+		t.Fatalf("missing part file: expected %q, got %v", ErrInvalidPart, err)
+	}
+}
+
+func TestUploaderListParts(t *testing.T) {
+	withCache(t)
+	u := newUploader()
+	mpu, err := u.Begin("owner", "bucket", "object", nil, uploadTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{1, 2, 4, 7} {
+		addPart(t, mpu, n, "part")
+	}
+	for _, tc := range []struct {
+		marker    int
+		limit     int64
+		parts     []int
+		truncated bool
+	}{
+		{0, 10, []int{1, 2, 4, 7}, false},
+		{0, 4, []int{1, 2, 4, 7}, false},
+		{0, 2, []int{1, 2}, true},
+		{2, 2, []int{4, 7}, false},
+		{3, 1, []int{4}, true},
+		{4, 1, []int{7}, false},
+		{7, 10, nil, false},
+		{0, 0, nil, true},
+	} {
+		result, err := u.ListParts("owner", "bucket", "object", mpu.ID, tc.marker, tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var parts []int
+		for _, part := range result.Parts {
+			parts = append(parts, part.PartNumber)
+		}
+		if fmt.Sprint(parts) != fmt.Sprint(tc.parts) || result.IsTruncated != tc.truncated {
+			t.Errorf("marker %d, limit %d: expected %v (truncated %v), got %v (truncated %v)", tc.marker, tc.limit, tc.parts, tc.truncated, parts, result.IsTruncated)
+		}
+		if len(parts) > 0 && result.NextPartNumberMarker != parts[len(parts)-1] {
+			t.Errorf("marker %d, limit %d: expected next marker %d, got %d", tc.marker, tc.limit, parts[len(parts)-1], result.NextPartNumberMarker)
+		}
+	}
+	if _, err := u.ListParts("other", "bucket", "object", mpu.ID, 0, 10); err != ErrNoSuchUpload {
+		t.Fatalf("list parts of another owner: expected %q, got %v", ErrNoSuchUpload, err)
+	}
+}
+
+func TestUploaderList(t *testing.T) {
+	withCache(t)
+	u := newUploader()
+	var ids = map[string][]UploadID{}
+	for _, object := range []string{"a", "b", "b", "dir/c", "dir/d", "e"} {
+		mpu, err := u.Begin("owner", "bucket", object, nil, uploadTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[object] = append(ids[object], mpu.ID)
+	}
+	if _, err := u.Begin("other", "bucket", "z", nil, uploadTime); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(marker *UploadListMarker, prefix Prefix, limit int64) ([]string, *ListMultipartUploadsResult) {
+		result, err := u.List("owner", "bucket", marker, prefix, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, upload := range result.Uploads {
+			keys = append(keys, upload.Key)
+		}
+		for _, p := range result.CommonPrefixes {
+			keys = append(keys, p.Prefix+"/")
+		}
+		return keys, result
+	}
+
+	keys, result := list(nil, Prefix{}, 100)
+	if fmt.Sprint(keys) != "[a b b dir/c dir/d e]" || result.IsTruncated {
+		t.Fatalf("list all: got %v (truncated %v)", keys, result.IsTruncated)
+	}
+
+	// A page can end between two uploads of the same key.
+	keys, result = list(nil, Prefix{}, 2)
+	if fmt.Sprint(keys) != "[a b]" || !result.IsTruncated || result.NextKeyMarker != "b" || result.NextUploadIDMarker != ids["b"][1] {
+		t.Fatalf("first page: got %v, %+v", keys, result)
+	}
+	keys, result = list(&UploadListMarker{Object: result.NextKeyMarker, UploadID: result.NextUploadIDMarker}, Prefix{}, 2)
+	if fmt.Sprint(keys) != "[b dir/c]" || !result.IsTruncated || result.NextKeyMarker != "dir/d" {
+		t.Fatalf("second page: got %v, %+v", keys, result)
+	}
+
+	keys, _ = list(nil, Prefix{Prefix: "dir/", HasPrefix: true}, 100)
+	if fmt.Sprint(keys) != "[dir/c dir/d]" {
+		t.Fatalf("list prefix: got %v", keys)
+	}
+
+	if _, err := u.List("nobody", "bucket", nil, Prefix{}, 100); err != ErrNoSuchUpload {
+		t.Fatalf("list another owner's bucket: expected %q, got %v", ErrNoSuchUpload, err)
+	}
+}
+
+func TestUploaderReap(t *testing.T) {
+	withCache(t)
+	u := newUploader()
+	begin := func(object string, initiated time.Time) *multipartUpload {
+		mpu, err := u.Begin("owner", "bucket", object, nil, initiated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addPart(t, mpu, 1, "12345")
+		return mpu
+	}
+	old := begin("old", uploadTime)
+	recent := begin("recent", uploadTime.Add(40*time.Hour))
+	ruled := begin("logs/ruled", uploadTime.Add(20*time.Hour))
+	if err := u.SetLifecycle("owner", "bucket", &LifecycleConfiguration{Rules: []LifecycleRule{{
+		Status:                         LifecycleEnabled,
+		Filter:                         &LifecycleFilter{Prefix: "logs/"},
+		AbortIncompleteMultipartUpload: &AbortIncompleteMultipartUpload{DaysAfterInitiation: 1},
+	}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	uploads, reclaimed := u.Reap(uploadTime.Add(48*time.Hour), 36*time.Hour)
+	if uploads != 2 || reclaimed != 10 {
+		t.Fatalf("expected 2 uploads and 10 bytes reaped, got %d and %d", uploads, reclaimed)
+	}
+	for _, mpu := range []*multipartUpload{old, ruled} {
+		if _, err := u.Get("owner", "bucket", mpu.Object, mpu.ID); err != ErrNoSuchUpload {
+			t.Fatalf("%s: expected %q, got %v", mpu.Object, ErrNoSuchUpload, err)
+		}
+	}
+	if _, err := u.Get("owner", "bucket", recent.Object, recent.ID); err != nil {
+		t.Fatalf("%s: %v", recent.Object, err)
+	}
+}
+
+func TestReapLegacyParts(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("bucket/object/1", "12345")
+	write("bucket/object/2", "67")
+	write("bucket/dir/object/1", "123")
+	write("bucket/kept/1", "1")
+	write("bucket/kept/notes.txt", "not a part")
+	write("bucket/zero/0", "1")
+	write("bucket/padded/01", "1")
+	write("Not_A_Bucket/object/1", "1")
+	write("_multipart/upload/1", "1")
+	write("_uploads.db", "registry")
+
+	now := time.Now()
+	if dirs, reclaimed := reapLegacyParts(dir, now.Add(time.Hour), 0); dirs != 0 || reclaimed != 0 {
+		t.Fatalf("max age zero: expected nothing reaped, got %d dirs and %d bytes", dirs, reclaimed)
+	}
+	if dirs, reclaimed := reapLegacyParts(dir, now, time.Hour); dirs != 0 || reclaimed != 0 {
+		t.Fatalf("recent parts: expected nothing reaped, got %d dirs and %d bytes", dirs, reclaimed)
+	}
+	dirs, reclaimed := reapLegacyParts(dir, now.Add(2*time.Hour), time.Hour)
+	if dirs != 2 || reclaimed != 10 {
+		t.Fatalf("expected 2 dirs and 10 bytes reaped, got %d dirs and %d bytes", dirs, reclaimed)
+	}
+	for _, name := range []string{"bucket/object", "bucket/dir"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s: expected it removed, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"bucket/kept/1", "bucket/zero/0", "bucket/padded/01", "Not_A_Bucket/object/1", "_multipart/upload/1", "_uploads.db"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s: expected it kept, got %v", name, err)
+		}
+	}
+}
@@ -10,19 +10,31 @@ import (
 	"strings"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/yottachain/YTCoreService/env"
 )
 
 type Yts3 struct {
 	storage                 Backend
 	versioned               VersionedBackend
+	copier                  CopyingBackend
+	tagging                 TaggingBackend
+	configs                 BucketConfigBackend
+	acls                    ACLBackend
 	timeSource              TimeSource
 	timeSkew                time.Duration
 	metadataSizeLimit       int
+	maxRanges               int
 	integrityCheck          bool
 	failOnUnimplementedPage bool
 	hostBucket              bool
+	credentials             CredentialProvider
+	auth                    Authenticator
+	registry                *UploadRegistry
+	reapMaxAge              time.Duration
+	reapInterval            time.Duration
 	uploader                *uploader
+	writeLocks              keyLocks
 	requestID               *env.AtomInt64
 	log                     Logger
 }
@@ -32,21 +44,42 @@ func New(backend Backend, options ...Option) *Yts3 {
 		storage:           backend,
 		timeSkew:          DefaultSkewLimit,
 		metadataSizeLimit: DefaultMetadataSizeLimit,
+		maxRanges:         DefaultMaxRanges,
 		integrityCheck:    true,
 		uploader:          newUploader(),
 		requestID:         env.NewAtomInt64(0),
 	}
 	// versioned MUST be set before options as one of the options disables it:
 	s3.versioned, _ = backend.(VersionedBackend)
+	s3.copier, _ = backend.(CopyingBackend)
+	s3.tagging, _ = backend.(TaggingBackend)
+	s3.configs, _ = backend.(BucketConfigBackend)
+	s3.acls, _ = backend.(ACLBackend)
 	for _, opt := range options {
 		opt(s3)
 	}
+	s3.uploader.configs = s3.configs
 	if s3.log == nil {
 		s3.log = DiscardLog()
 	}
 	if s3.timeSource == nil {
 		s3.timeSource = DefaultTimeSource()
 	}
+	if s3.registry != nil {
+		if err := s3.uploader.restore(s3.registry); err != nil {
+			logrus.Errorf("[MultipartUpload]Restore uploads err:%s\n", err)
+		}
+	}
+	if s3.reapInterval > 0 {
+		go s3.uploader.reapLoop(s3.timeSource, s3.reapMaxAge, s3.reapInterval)
+	}
+	if s3.auth == nil {
+		if s3.credentials != nil {
+			s3.auth = NewSignatureAuthenticator(s3.credentials, s3.timeSource, s3.timeSkew, s3.hostBucket)
+		} else {
+			s3.auth = headerAuthenticator{}
+		}
+	}
 	return s3
 }
 
@@ -95,6 +128,24 @@ func listBucketPageFromQuery(query url.Values) (page ListBucketPage, rerr error)
 	return page, nil
 }
 
+func listBucketVersionsPageFromQuery(query url.Values) (page ListBucketVersionsPage, rerr error) {
+	maxKeys, err := parseClampedInt(query.Get("max-keys"), DefaultMaxBucketVersionKeys, 0, MaxBucketVersionKeys)
+	if err != nil {
+		return page, err
+	}
+	page.MaxKeys = maxKeys
+	if _, page.HasKeyMarker = query["key-marker"]; page.HasKeyMarker {
+		page.KeyMarker = query.Get("key-marker")
+	}
+	if _, page.HasVersionIDMarker = query["version-id-marker"]; page.HasVersionIDMarker {
+		page.VersionIDMarker = VersionID(query.Get("version-id-marker"))
+	}
+	if page.HasVersionIDMarker && !page.HasKeyMarker {
+		return page, ErrorMessage(ErrInvalidArgument, "A version-id marker cannot be specified without a key marker.")
+	}
+	return page, nil
+}
+
 func formatHeaderTime(t time.Time) string {
 	tc := t.In(time.UTC)
 	return tc.Format("Mon, 02 Jan 2006 15:04:05") + " GMT"
@@ -107,6 +158,18 @@ func metadataSize(meta map[string]string) int {
 	}
 	return total
 }
+
+// storedHeaders are the standard headers that are stored with an object and
+// returned when it is read.
+var storedHeaders = []string{
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Type",
+	"Expires",
+}
+
 func metadataHeaders(headers map[string][]string, at time.Time, sizeLimit int) (map[string]string, error) {
 	meta := make(map[string]string)
 	for hk, hv := range headers {
@@ -114,12 +177,49 @@ func metadataHeaders(headers map[string][]string, at time.Time, sizeLimit int) (
 			meta[hk] = hv[0]
 		}
 	}
+	for _, hk := range storedHeaders {
+		if hv, ok := headers[hk]; ok && len(hv) > 0 {
+			meta[hk] = hv[0]
+		}
+	}
+	if v, ok := meta["Content-Encoding"]; ok {
+		if v = stripAWSChunked(v); v != "" {
+			meta["Content-Encoding"] = v
+		} else {
+			delete(meta, "Content-Encoding")
+		}
+	}
+	if err := normalizeTaggingHeader(meta); err != nil {
+		return meta, err
+	}
 	meta["Last-Modified"] = formatHeaderTime(at)
 	if sizeLimit > 0 && metadataSize(meta) > sizeLimit {
 		return meta, ErrMetadataTooLarge
 	}
 	return meta, nil
 }
+
+// ObjectMetadata returns the part of meta, as collected from the request
+// headers, that a Backend stores with the object: the standard headers such
+// as Content-Type and the x-amz-meta-* user metadata.
+func ObjectMetadata(meta map[string]string) map[string]string {
+	stored := make(map[string]string)
+	for k, v := range meta {
+		if strings.HasPrefix(k, "X-Amz-Meta-") {
+			stored[k] = v
+		}
+	}
+	for _, k := range storedHeaders {
+		if v, ok := meta[k]; ok {
+			stored[k] = v
+		}
+	}
+	if v, ok := meta[TaggingMetaKey]; ok {
+		stored[TaggingMetaKey] = v
+	}
+	return stored
+}
+
 func (g *Yts3) nextRequestID() uint64 {
 	return uint64(g.requestID.Add(1))
 }
@@ -148,32 +248,15 @@ func (g *Yts3) xmlEncoder(w http.ResponseWriter) *xml.Encoder {
 
 func (g *Yts3) Server() http.Handler {
 	var handler http.Handler = &withCORS{r: http.HandlerFunc(g.routeBase), log: g.log}
-	if g.timeSkew != 0 {
-		handler = g.timeSkewMiddleware(handler)
-	}
 	if g.hostBucket {
 		handler = g.hostBucketMiddleware(handler)
 	}
+	// The signature covers the path the client sent, so the caller has to be
+	// authenticated before hostBucketMiddleware rewrites it.
+	handler = g.authMiddleware(handler)
 	return handler
 }
 
-func (g *Yts3) timeSkewMiddleware(handler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
-		timeHdr := rq.Header.Get("x-amz-date")
-		if timeHdr != "" {
-			// rqTime, _ := time.ParseInLocation("20060102T150405Z", timeHdr, time.Local)
-			// at := g.timeSource.Now()
-			// skew := at.Sub(rqTime)
-
-			// if skew < -g.timeSkew || skew > g.timeSkew {
-			// 	g.httpError(w, rq, requestTimeTooSkewed(at, g.timeSkew))
-			// 	return
-			// }
-		}
-		handler.ServeHTTP(w, rq)
-	})
-}
-
 func (g *Yts3) hostBucketMiddleware(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
 		parts := strings.SplitN(rq.Host, ".", 2)
@@ -196,13 +279,18 @@ func (g *Yts3) writeGetOrHeadObjectResponse(obj *Object, w http.ResponseWriter,
 		return KeyNotFound(obj.Name)
 	}
 	for mk, mv := range obj.Metadata {
+		if mk == TaggingMetaKey || mk == ACLMetaKey {
+			continue
+		}
 		w.Header().Set(mk, mv)
 	}
+	if count := taggingCount(obj.Metadata); count != "" {
+		w.Header().Set("x-amz-tagging-count", count)
+	}
 	w.Header().Set("Accept-Ranges", "bytes")
 	// w.Header().Set("ETag", `"`+hex.EncodeToString(obj.Hash)+`"`)
 	etag := obj.Metadata["ETag"]
-	// newETag := etag[1 : len(etag)-1]
-	w.Header().Set("ETag", etag)
+	w.Header().Set("ETag", `"`+strings.Trim(etag, `"`)+`"`)
 	w.Header().Set("Content-Length", string(obj.Size))
 	if obj.VersionID != "" {
 		w.Header().Set("x-amz-version-id", string(obj.VersionID))